@@ -0,0 +1,97 @@
+// Package checksum provides the checksum algorithms used by the WAL and SST
+// file formats. Each algorithm has a one byte ID that files record, so a
+// reader verifies a file with whatever algorithm it was written with.
+package checksum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Algorithm identifies a checksum algorithm on disk. Every algorithm produces
+// a 32 bit sum so that it fits the same fields; XXHash64 is truncated to its
+// low 32 bits.
+type Algorithm uint8
+
+const (
+	CRC32IEEE Algorithm = 1
+	// CRC32C is the Castagnoli polynomial, which detects more errors than
+	// IEEE and is hardware accelerated on amd64 and arm64.
+	CRC32C   Algorithm = 2
+	XXHash64 Algorithm = 3
+)
+
+// Default is the algorithm used when none is chosen.
+const Default = CRC32IEEE
+
+var ErrUnknownAlgorithm = fmt.Errorf("unknown checksum algorithm")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (a Algorithm) String() string {
+	switch a {
+	case CRC32IEEE:
+		return "crc32"
+	case CRC32C:
+		return "crc32c"
+	case XXHash64:
+		return "xxhash64"
+	}
+	return fmt.Sprintf("Algorithm(%d)", uint8(a))
+}
+
+// Validate returns ErrUnknownAlgorithm if a is not a known algorithm.
+func (a Algorithm) Validate() error {
+	switch a {
+	case CRC32IEEE, CRC32C, XXHash64:
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownAlgorithm, uint8(a))
+}
+
+// Checksum returns the sum of b. It panics if a is not valid.
+func (a Algorithm) Checksum(b []byte) uint32 {
+	switch a {
+	case CRC32IEEE:
+		return crc32.ChecksumIEEE(b)
+	case CRC32C:
+		return crc32.Checksum(b, castagnoli)
+	case XXHash64:
+		return uint32(xxhash.Sum64(b))
+	}
+	panic(fmt.Sprintf("checksum: unknown algorithm %d", uint8(a)))
+}
+
+// New returns a streaming hash for a. It panics if a is not valid.
+func (a Algorithm) New() hash.Hash32 {
+	switch a {
+	case CRC32IEEE:
+		return crc32.NewIEEE()
+	case CRC32C:
+		return crc32.New(castagnoli)
+	case XXHash64:
+		return xxhash32{xxhash.New()}
+	}
+	panic(fmt.Sprintf("checksum: unknown algorithm %d", uint8(a)))
+}
+
+// xxhash32 presents the low 32 bits of an xxhash64 digest as a hash.Hash32.
+type xxhash32 struct {
+	*xxhash.Digest
+}
+
+func (x xxhash32) Size() int {
+	return 4
+}
+
+func (x xxhash32) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, x.Sum32())
+}
+
+func (x xxhash32) Sum32() uint32 {
+	return uint32(x.Sum64())
+}
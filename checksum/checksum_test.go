@@ -0,0 +1,48 @@
+package checksum
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog")
+
+	tests := []struct {
+		alg  Algorithm
+		want uint32
+	}{
+		{CRC32IEEE, 0x414fa339},
+		{CRC32C, 0x22620404},
+		{XXHash64, 0x1fda71bc}, // low half of 0x0b242d361fda71bc
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg.String(), func(t *testing.T) {
+			if err := tt.alg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.alg.Checksum(data); got != tt.want {
+				t.Fatalf("Checksum = %#x, want %#x", got, tt.want)
+			}
+
+			h := tt.alg.New()
+			_, _ = h.Write(data[:10])
+			_, _ = h.Write(data[10:])
+			if got := h.Sum32(); got != tt.want {
+				t.Fatalf("streaming sum = %#x, want %#x", got, tt.want)
+			}
+			if len(h.Sum(nil)) != h.Size() {
+				t.Fatalf("Sum length %d != Size %d", len(h.Sum(nil)), h.Size())
+			}
+		})
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	for _, a := range []Algorithm{0, 4, 255} {
+		if err := a.Validate(); !errors.Is(err, ErrUnknownAlgorithm) {
+			t.Fatalf("%v: expected ErrUnknownAlgorithm, got %v", a, err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ module github.com/Priyanshu23/FlashLogGo
 go 1.25.5
 
 require (
-	github.com/bits-and-blooms/bitset v1.24.4 // indirect
-	github.com/bits-and-blooms/bloom/v3 v3.7.1 // indirect
+	github.com/bits-and-blooms/bloom/v3 v3.7.1
+	github.com/cespare/xxhash/v2 v2.3.0
 )
+
+require github.com/bits-and-blooms/bitset v1.24.4 // indirect
@@ -0,0 +1,130 @@
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/wal"
+)
+
+const DefaultRetryInterval = time.Second
+
+type followerOptions struct {
+	retryInterval time.Duration
+}
+
+type FollowerOption func(*followerOptions)
+
+// WithRetryInterval sets how long the follower waits before reconnecting.
+func WithRetryInterval(d time.Duration) FollowerOption {
+	return func(o *followerOptions) {
+		o.retryInterval = d
+	}
+}
+
+// Follower appends the records streamed by a Primary to its own WALWriter.
+type Follower struct {
+	w    *wal.WALWriter
+	addr string
+	opts followerOptions
+}
+
+func NewFollower(w *wal.WALWriter, addr string, opts ...FollowerOption) *Follower {
+	o := followerOptions{
+		retryInterval: DefaultRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Follower{w: w, addr: addr, opts: o}
+}
+
+// Run replicates until ctx is done, reconnecting after connection errors and
+// resuming after the last record in the follower's WAL. It returns nil once
+// ctx is done, or the error that makes replication impossible, such as
+// ErrTooFarBehind.
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		err := f.replicate(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if fatal(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(f.opts.retryInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// fatal reports whether retrying cannot help.
+func fatal(err error) bool {
+	return errors.Is(err, ErrUnsupportedVersion) ||
+		errors.Is(err, ErrTooFarBehind) ||
+		errors.Is(err, ErrAhead) ||
+		errors.Is(err, wal.ErrEntryTooLarge) ||
+		errors.Is(err, wal.ErrLSNOutOfOrder) ||
+		errors.Is(err, wal.ErrWALClosed)
+}
+
+// replicate runs a single connection to the primary.
+func (f *Follower) replicate(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", f.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to primary: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	var hello [9]byte
+	hello[0] = protocolVersion
+	binary.LittleEndian.PutUint64(hello[1:], f.w.LastLSN())
+	if _, err := conn.Write(hello[:]); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		return fmt.Errorf("failed to read handshake: %w", err)
+	}
+	if err := statusError(status[0]); err != nil {
+		return err
+	}
+
+	var frame []byte
+	var ack [8]byte
+	for {
+		if frame, err = readFrame(conn, frame); err != nil {
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+
+		l, err := wal.DecodeBytes(frame)
+		if err != nil {
+			return fmt.Errorf("failed to decode record: %w", err)
+		}
+		if err := f.w.Append(l); err != nil {
+			return fmt.Errorf("failed to append record %d: %w", l.LSN(), err)
+		}
+
+		binary.LittleEndian.PutUint64(ack[:], l.LSN())
+		if _, err := conn.Write(ack[:]); err != nil {
+			return fmt.Errorf("failed to acknowledge record %d: %w", l.LSN(), err)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package replication
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/wal"
+)
+
+const DefaultAckTimeout = 5 * time.Second
+
+type options struct {
+	syncReplicas int
+	ackTimeout   time.Duration
+}
+
+type Option func(*options)
+
+// WithSyncReplicas makes Write wait until n followers have acknowledged the
+// record before it returns.
+func WithSyncReplicas(n int) Option {
+	return func(o *options) {
+		o.syncReplicas = n
+	}
+}
+
+// WithAckTimeout bounds how long Write waits for acknowledgements.
+func WithAckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.ackTimeout = d
+	}
+}
+
+// FollowerStatus describes a connected follower.
+type FollowerStatus struct {
+	Addr     string
+	AckedLSN uint64
+}
+
+// Primary streams the records of a WALWriter to the followers that connect to
+// it. It does not own the writer; close the Primary before the writer.
+type Primary struct {
+	w    *wal.WALWriter
+	opts options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	followers map[net.Conn]uint64 // acknowledged LSN per connection
+	ackCh     chan struct{}       // closed and replaced on every acknowledgement
+	closed    bool
+}
+
+// NewPrimary returns a Primary for w. Records are only shipped once they are
+// durable, so w's sync policy must be SyncAlways or SyncEvery; under
+// SyncEveryBytes or SyncNever shipping would stall until enough, or any, data
+// is synced, and NewPrimary fails with ErrUnboundedSync.
+func NewPrimary(w *wal.WALWriter, opts ...Option) (*Primary, error) {
+	if policy := w.Stats().SyncPolicy; !policy.Bounded() {
+		return nil, fmt.Errorf("%w: %s", ErrUnboundedSync, policy)
+	}
+
+	o := options{
+		ackTimeout: DefaultAckTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Primary{
+		w:         w,
+		opts:      o,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: make(map[net.Listener]struct{}),
+		followers: make(map[net.Conn]uint64),
+		ackCh:     make(chan struct{}),
+	}, nil
+}
+
+// Serve accepts followers on ln until the Primary is closed, then returns nil.
+func (p *Primary) Serve(ln net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		_ = ln.Close()
+		return ErrClosed
+	}
+	p.listeners[ln] = struct{}{}
+	p.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.serveConn(conn)
+		}()
+	}
+}
+
+// Write writes l through the primary's WALWriter and, under WithSyncReplicas,
+// waits for the followers to acknowledge it. On ErrAckTimeout the record is
+// durable locally but not known to be replicated.
+func (p *Primary) Write(l *wal.Log) (uint64, error) {
+	lsn, err := p.w.Write(l)
+	if err != nil {
+		return lsn, err
+	}
+	return lsn, p.waitAcks(lsn)
+}
+
+// WriteBatch is Write for a batch.
+func (p *Primary) WriteBatch(b *wal.Batch) (uint64, error) {
+	return p.Write(b.Log())
+}
+
+// Followers lists the connected followers.
+func (p *Primary) Followers() []FollowerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]FollowerStatus, 0, len(p.followers))
+	for conn, acked := range p.followers {
+		status = append(status, FollowerStatus{Addr: conn.RemoteAddr().String(), AckedLSN: acked})
+	}
+	return status
+}
+
+// Close stops accepting followers and disconnects the connected ones.
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.cancel()
+
+	for ln := range p.listeners {
+		_ = ln.Close()
+	}
+	for conn := range p.followers {
+		_ = conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Primary) waitAcks(lsn uint64) error {
+	if p.opts.syncReplicas <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(p.opts.ackTimeout)
+	defer timer.Stop()
+
+	for {
+		p.mu.Lock()
+		acked := 0
+		for _, a := range p.followers {
+			if a >= lsn {
+				acked++
+			}
+		}
+		ch := p.ackCh
+		p.mu.Unlock()
+
+		if acked >= p.opts.syncReplicas {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			return ErrAckTimeout
+		case <-p.ctx.Done():
+			return ErrClosed
+		}
+	}
+}
+
+func (p *Primary) ack(conn net.Conn, lsn uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if lsn > p.followers[conn] {
+		p.followers[conn] = lsn
+	}
+	close(p.ackCh)
+	p.ackCh = make(chan struct{})
+}
+
+// register adds conn to the followers, unless the Primary is closing.
+func (p *Primary) register(conn net.Conn, from uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+	p.followers[conn] = from
+	return true
+}
+
+func (p *Primary) unregister(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.followers, conn)
+}
+
+// handshake reads the follower's hello and answers it. It returns the LSN the
+// follower has and a reader positioned at the record after it.
+func (p *Primary) handshake(conn net.Conn) (uint64, *wal.WALReader, error) {
+	var hello [9]byte
+	if _, err := io.ReadFull(conn, hello[:]); err != nil {
+		return 0, nil, err
+	}
+	from := binary.LittleEndian.Uint64(hello[1:])
+
+	status := byte(statusOK)
+	var reader *wal.WALReader
+	switch {
+	case hello[0] != protocolVersion:
+		status = statusUnsupportedVersion
+	case from > p.w.LastLSN():
+		status = statusAhead
+	default:
+		var err error
+		reader, err = wal.NewWALReader(p.w.Dir(), wal.WithFollowWriter(p.w), wal.WithBufferReuse())
+		if err != nil {
+			return 0, nil, err
+		}
+		// Records covered by the checkpoint may already be gone.
+		if from < reader.CheckpointLSN() {
+			_ = reader.Close()
+			reader, status = nil, statusTooFarBehind
+		} else if err := reader.SeekTo(from + 1); err != nil {
+			_ = reader.Close()
+			return 0, nil, err
+		}
+	}
+
+	if _, err := conn.Write([]byte{status}); err != nil || reader == nil {
+		if reader != nil {
+			_ = reader.Close()
+		}
+		return 0, nil, errors.Join(err, statusError(status))
+	}
+
+	return from, reader, nil
+}
+
+func (p *Primary) serveConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	from, reader, err := p.handshake(conn)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if !p.register(conn, from) {
+		return
+	}
+	defer p.unregister(conn)
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	// Acknowledgements flow back on the same connection. When it breaks,
+	// stop streaming too.
+	go func() {
+		defer cancel()
+		var buf [8]byte
+		for {
+			if _, err := io.ReadFull(conn, buf[:]); err != nil {
+				return
+			}
+			p.ack(conn, binary.LittleEndian.Uint64(buf[:]))
+		}
+	}()
+
+	var frame []byte
+	for l, err := range reader.Follow(ctx) {
+		if err != nil {
+			return
+		}
+
+		if frame, err = appendFrame(frame[:0], &l); err != nil {
+			// The follower would only ask for this record again.
+			if errors.Is(err, wal.ErrEntryTooLarge) {
+				_, _ = conn.Write(appendErrorFrame(frame[:0], statusEntryTooLarge, l.LSN()))
+			}
+			return
+		}
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
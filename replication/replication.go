@@ -0,0 +1,118 @@
+// Package replication ships WAL records from a primary to followers over TCP.
+//
+// A follower connects and sends the LSN of the last record in its own WAL:
+// | VERSION (1) | FROM_LSN (8) |
+// The primary answers with a STATUS (1) byte and, if it is statusOK, streams
+// every record above FROM_LSN once it is durable, in LSN order:
+// | LEN (4) | RECORD |
+// RECORD is an encoded WAL record. The follower appends each record to its own
+// WAL under the same LSN and acknowledges it with:
+// | LSN (8) |
+// Records are re-encoded for shipping, so ones over wal.MaxEntrySize, which
+// only block framed WALs accept, cannot be replicated. The primary sends
+// | errorFrame (4) | STATUS (1) | LSN (8) |
+// in place of such a record and closes the connection, and the follower stops
+// with the matching error.
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/Priyanshu23/FlashLogGo/wal"
+)
+
+const protocolVersion = 1
+
+const (
+	statusOK                 = 0
+	statusUnsupportedVersion = 1
+	statusTooFarBehind       = 2
+	statusAhead              = 3
+	statusEntryTooLarge      = 4
+)
+
+var (
+	ErrClosed             = os.ErrClosed
+	ErrUnsupportedVersion = fmt.Errorf("unsupported replication protocol version")
+	ErrTooFarBehind       = fmt.Errorf("follower is behind the primary's checkpoint")
+	ErrAhead              = fmt.Errorf("follower is ahead of the primary")
+	ErrAckTimeout         = fmt.Errorf("timed out waiting for follower acknowledgements")
+	ErrUnboundedSync      = fmt.Errorf("primary's WAL sync policy does not bound when records become durable")
+)
+
+// statusError maps a handshake status to the error the follower reports.
+func statusError(status byte) error {
+	switch status {
+	case statusOK:
+		return nil
+	case statusUnsupportedVersion:
+		return ErrUnsupportedVersion
+	case statusTooFarBehind:
+		return ErrTooFarBehind
+	case statusAhead:
+		return ErrAhead
+	case statusEntryTooLarge:
+		return wal.ErrEntryTooLarge
+	}
+	return fmt.Errorf("unknown handshake status %d", status)
+}
+
+// maxFrameSize bounds LEN so a damaged stream cannot make the follower
+// allocate without limit.
+const maxFrameSize = 4 + wal.MaxEntrySize
+
+// errorFrame is the LEN of a frame that reports why a record cannot be sent.
+const errorFrame = math.MaxUint32
+
+// readFrame reads the next | LEN (4) | RECORD | frame into buf.
+func readFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return buf, err
+	}
+
+	n := binary.LittleEndian.Uint32(head[:])
+	if n == errorFrame {
+		var rest [9]byte
+		if _, err := io.ReadFull(r, rest[:]); err != nil {
+			return buf, err
+		}
+		return buf, fmt.Errorf("primary cannot send record %d: %w", binary.LittleEndian.Uint64(rest[1:]), statusError(rest[0]))
+	}
+	if n > maxFrameSize {
+		return buf, fmt.Errorf("replication frame of %d bytes: %w", n, wal.ErrCorruptWAL)
+	}
+
+	if cap(buf) < int(n) {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+// appendErrorFrame appends an error frame for the record lsn to dst.
+func appendErrorFrame(dst []byte, status byte, lsn uint64) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, errorFrame)
+	dst = append(dst, status)
+	return binary.LittleEndian.AppendUint64(dst, lsn)
+}
+
+// appendFrame appends l to dst as a frame.
+func appendFrame(dst []byte, l *wal.Log) ([]byte, error) {
+	start := len(dst)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+
+	dst, err := l.AppendEncode(dst)
+	if err != nil {
+		return dst[:start], err
+	}
+
+	binary.LittleEndian.PutUint32(dst[start:], uint32(len(dst)-start-4))
+	return dst, nil
+}
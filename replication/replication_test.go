@@ -0,0 +1,315 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/wal"
+)
+
+func startPrimary(t *testing.T, opts ...Option) (*wal.WALWriter, *Primary, string) {
+	t.Helper()
+	w, err := wal.NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPrimary(w, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- p.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		_ = p.Close()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+		w.Close()
+	})
+
+	return w, p, ln.Addr().String()
+}
+
+// startFollower runs a follower until the returned stop function is called,
+// which returns Run's error.
+func startFollower(t *testing.T, w *wal.WALWriter, addr string) func() error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewFollower(w, addr, WithRetryInterval(10*time.Millisecond)).Run(ctx)
+	}()
+
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+func write(t *testing.T, p *Primary, keys ...string) {
+	t.Helper()
+	for _, k := range keys {
+		if _, err := p.Write(wal.NewLog(types.OperationPut, []byte(k), []byte("v-"+k))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func keyRange(from, to int) []string {
+	var keys []string
+	for i := from; i < to; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	return keys
+}
+
+func waitForLSN(t *testing.T, w *wal.WALWriter, lsn uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for w.LastLSN() < lsn {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower stuck at LSN %d, want %d", w.LastLSN(), lsn)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readLog returns the key and LSN of every record in dir.
+func readLog(t *testing.T, dir string) []string {
+	t.Helper()
+	reader, err := wal.NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var records []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, fmt.Sprintf("%d:%s=%s", l.LSN(), l.Key(), l.Value()))
+	}
+	return records
+}
+
+func TestReplicationWaitsForAcks(t *testing.T) {
+	primaryWAL, p, addr := startPrimary(t, WithSyncReplicas(1))
+
+	followerWAL, err := wal.NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer followerWAL.Close()
+	stop := startFollower(t, followerWAL, addr)
+
+	// Every Write returns only once the follower has the record.
+	for i, k := range keyRange(0, 10) {
+		write(t, p, k)
+		if got := followerWAL.LastLSN(); got != uint64(i+1) {
+			t.Fatalf("follower at LSN %d after write %d", got, i+1)
+		}
+	}
+
+	if status := p.Followers(); len(status) != 1 || status[0].AckedLSN != 10 {
+		t.Fatalf("unexpected follower status %+v", status)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readLog(t, followerWAL.Dir()), readLog(t, primaryWAL.Dir()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("follower log %v differs from primary %v", got, want)
+	}
+}
+
+func TestReplicationResumesAfterDisconnect(t *testing.T) {
+	primaryWAL, p, addr := startPrimary(t)
+
+	followerDir := t.TempDir()
+	followerWAL, err := wal.NewWALWriter(1, followerDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, p, keyRange(0, 5)...)
+	stop := startFollower(t, followerWAL, addr)
+	waitForLSN(t, followerWAL, 5)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The follower restarts from its own WAL while the primary moves on.
+	followerWAL.Close()
+	write(t, p, keyRange(5, 10)...)
+
+	followerWAL, err = wal.NewWALWriter(1, followerDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer followerWAL.Close()
+
+	stop = startFollower(t, followerWAL, addr)
+	write(t, p, keyRange(10, 15)...)
+	waitForLSN(t, followerWAL, 15)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := readLog(t, followerDir), readLog(t, primaryWAL.Dir()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("follower log %v differs from primary %v", got, want)
+	}
+}
+
+func TestReplicationAckTimeout(t *testing.T) {
+	primaryWAL, p, _ := startPrimary(t, WithSyncReplicas(1), WithAckTimeout(20*time.Millisecond))
+
+	lsn, err := p.Write(wal.NewLog(types.OperationPut, []byte("lonely"), nil))
+	if !errors.Is(err, ErrAckTimeout) {
+		t.Fatalf("expected ErrAckTimeout, got %v", err)
+	}
+	if lsn != 1 || primaryWAL.LastLSN() != 1 {
+		t.Fatalf("record should still be written locally, got LSN %d", lsn)
+	}
+}
+
+func TestReplicationRejectsFollowerBehindCheckpoint(t *testing.T) {
+	primaryWAL, p, addr := startPrimary(t)
+	write(t, p, keyRange(0, 3)...)
+	if err := primaryWAL.Checkpoint(2); err != nil {
+		t.Fatal(err)
+	}
+
+	followerWAL, err := wal.NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer followerWAL.Close()
+
+	err = NewFollower(followerWAL, addr).Run(context.Background())
+	if !errors.Is(err, ErrTooFarBehind) {
+		t.Fatalf("expected ErrTooFarBehind, got %v", err)
+	}
+}
+
+func TestReplicationReportsOversizedRecord(t *testing.T) {
+	primaryWAL, err := wal.NewWALWriter(1, t.TempDir(), wal.WithBlockFraming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primaryWAL.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPrimary(primaryWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = p.Close()
+	}()
+	go func() {
+		_ = p.Serve(ln)
+	}()
+
+	write(t, p, "small")
+	big := make([]byte, wal.MaxEntrySize+1)
+	if _, err := p.Write(wal.NewLog(types.OperationPut, []byte("big"), big)); err != nil {
+		t.Fatal(err)
+	}
+
+	followerWAL, err := wal.NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer followerWAL.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = NewFollower(followerWAL, ln.Addr().String()).Run(ctx)
+	if !errors.Is(err, wal.ErrEntryTooLarge) {
+		t.Fatalf("expected ErrEntryTooLarge, got %v", err)
+	}
+	if followerWAL.LastLSN() != 1 {
+		t.Fatalf("expected the record before to be replicated, follower at LSN %d", followerWAL.LastLSN())
+	}
+}
+
+func TestPrimaryRequiresBoundedSync(t *testing.T) {
+	tests := []struct {
+		policy wal.SyncPolicy
+		ok     bool
+	}{
+		{wal.SyncAlways(), true},
+		{wal.SyncEvery(20 * time.Millisecond), true},
+		{wal.SyncEveryBytes(1 << 20), false},
+		{wal.SyncNever(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			primaryWAL, err := wal.NewWALWriter(1, t.TempDir(), wal.WithSyncPolicy(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer primaryWAL.Close()
+
+			p, err := NewPrimary(primaryWAL, WithSyncReplicas(1))
+			if !tt.ok {
+				if !errors.Is(err, ErrUnboundedSync) {
+					t.Fatalf("expected ErrUnboundedSync, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = p.Close()
+			}()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				_ = p.Serve(ln)
+			}()
+
+			followerWAL, err := wal.NewWALWriter(1, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer followerWAL.Close()
+			stop := startFollower(t, followerWAL, ln.Addr().String())
+			defer func() {
+				_ = stop()
+			}()
+
+			// A single write, with nothing after it to push it out, still
+			// reaches the follower.
+			write(t, p, "only")
+			if got := followerWAL.LastLSN(); got != 1 {
+				t.Fatalf("follower at LSN %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package segmentmanager
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+var (
+	ErrClosed        = os.ErrClosed
+	ErrActiveSegment = fmt.Errorf("cannot remove the active segment")
+)
+
+type diskSegmentManager struct {
+	mu       sync.Mutex
+	dir      string
+	fs       vfs.FS
+	opts     options
+	activeID int
+	active   vfs.File
+	size     int64
+	base     int64 // size of the active segment before its first entry
+	reserved int64 // file size of the active segment, at least size
+	recycled []string
+	closed   bool
+}
+
+// NewDiskSegmentManager opens the segments in dir, continuing to append to the
+// newest one, or creates segment-0001.log if the directory holds none.
+func NewDiskSegmentManager(dir string, opts ...Option) (SegmentManager, error) {
+	o := options{
+		maxSegmentSize: DefaultMaxSegmentSize,
+		fs:             vfs.OS(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := o.fs.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	segments, err := ListSegmentsFS(o.fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	sm := &diskSegmentManager{
+		dir:  dir,
+		fs:   o.fs,
+		opts: o,
+	}
+	if sm.recycled, err = sm.loadRecycled(); err != nil {
+		return nil, err
+	}
+
+	if len(segments) == 0 {
+		if err := sm.create(1); err != nil {
+			return nil, err
+		}
+		return sm, nil
+	}
+
+	last := segments[len(segments)-1]
+	f, err := o.fs.OpenFile(last.Path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to seek to end of segment: %w", err)
+	}
+
+	sm.activeID = last.ID
+	sm.active = f
+	sm.size = size
+	sm.reserved = size
+
+	if size == 0 {
+		if err := sm.writeHeader(); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	return sm, nil
+}
+
+func (sm *diskSegmentManager) writeHeader() error {
+	if sm.opts.header == nil {
+		return nil
+	}
+
+	cw := &countingWriter{w: sm.active}
+	if err := sm.opts.header(cw); err != nil {
+		return fmt.Errorf("failed to write segment header: %w", err)
+	}
+
+	sm.size += cw.n
+	sm.base = sm.size
+
+	return nil
+}
+
+func (sm *diskSegmentManager) create(id int) error {
+	path := filepath.Join(sm.dir, SegmentName(id))
+
+	f, reserved, err := sm.reuse(path)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		if f, err = sm.fs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644); err != nil {
+			return fmt.Errorf("failed to create segment: %w", err)
+		}
+	}
+
+	// Make the new directory entry durable so the segment survives a crash.
+	if err := sm.syncDir(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	sm.activeID = id
+	sm.active = f
+	sm.size = 0
+	sm.base = 0
+	sm.reserved = reserved
+
+	return sm.writeHeader()
+}
+
+// reuse turns the oldest recycled segment into a new segment at path. It
+// returns a nil file if there is none. The file is zeroed before it is
+// renamed, so a crash cannot leave old entries under the new name.
+func (sm *diskSegmentManager) reuse(path string) (vfs.File, int64, error) {
+	if len(sm.recycled) == 0 {
+		return nil, 0, nil
+	}
+	old := sm.recycled[0]
+
+	f, err := sm.fs.OpenFile(old, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open recycled segment: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err == nil {
+		err = zeroFill(f, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = sm.fs.Rename(old, path)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, fmt.Errorf("failed to recycle segment: %w", err)
+	}
+
+	sm.recycled = sm.recycled[1:]
+
+	return f, info.Size(), nil
+}
+
+// reserve makes sure the active segment has room for n more bytes when
+// preallocating.
+func (sm *diskSegmentManager) reserve(n int64) error {
+	chunk := sm.opts.preallocate
+	need := sm.size + n
+	if chunk <= 0 || need <= sm.reserved {
+		return nil
+	}
+
+	target := (need + chunk - 1) / chunk * chunk
+	if target > sm.opts.maxSegmentSize && need <= sm.opts.maxSegmentSize {
+		target = sm.opts.maxSegmentSize
+	}
+
+	if err := preallocate(sm.active, sm.reserved, target-sm.reserved); err != nil {
+		return fmt.Errorf("failed to preallocate segment: %w", err)
+	}
+	sm.reserved = target
+
+	return nil
+}
+
+// trim cuts reserved space that was never written off the active segment.
+func (sm *diskSegmentManager) trim() error {
+	if sm.reserved <= sm.size {
+		return nil
+	}
+
+	if err := sm.active.Truncate(sm.size); err != nil {
+		return fmt.Errorf("failed to trim segment: %w", err)
+	}
+	sm.reserved = sm.size
+
+	return nil
+}
+
+func (sm *diskSegmentManager) sync() error {
+	if sm.opts.preallocate > 0 || sm.opts.recycle > 0 {
+		return datasync(sm.active)
+	}
+	return sm.active.Sync()
+}
+
+func (sm *diskSegmentManager) rotate() error {
+	if err := sm.trim(); err != nil {
+		return err
+	}
+	if err := sm.sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	if err := sm.active.Close(); err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+
+	return sm.create(sm.activeID + 1)
+}
+
+func (sm *diskSegmentManager) WriteActive(entrySize int, fn func(w io.Writer) error) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return ErrClosed
+	}
+
+	if sm.size > sm.base && sm.size+int64(entrySize) > sm.opts.maxSegmentSize {
+		if err := sm.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := sm.reserve(int64(entrySize)); err != nil {
+		return err
+	}
+
+	cw := &countingWriter{w: sm.active}
+	if err := fn(cw); err != nil {
+		// Drop whatever part of the entry made it to the file so the next
+		// entry does not land behind garbage.
+		if tErr := sm.active.Truncate(sm.size); tErr != nil {
+			return fmt.Errorf("failed to discard partial entry: %w", tErr)
+		}
+		sm.reserved = sm.size
+		if _, sErr := sm.active.Seek(sm.size, io.SeekStart); sErr != nil {
+			return fmt.Errorf("failed to discard partial entry: %w", sErr)
+		}
+		return err
+	}
+
+	sm.size += cw.n
+	sm.reserved = max(sm.reserved, sm.size)
+
+	return nil
+}
+
+func (sm *diskSegmentManager) Active() (int, int64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.activeID, sm.size
+}
+
+func (sm *diskSegmentManager) Sync() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return ErrClosed
+	}
+
+	return sm.sync()
+}
+
+func (sm *diskSegmentManager) Segments() ([]Segment, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return ListSegmentsFS(sm.fs, sm.dir)
+}
+
+func (sm *diskSegmentManager) Remove(id int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if id == sm.activeID {
+		return ErrActiveSegment
+	}
+
+	path := filepath.Join(sm.dir, SegmentName(id))
+	if len(sm.recycled) < sm.opts.recycle {
+		recycled := filepath.Join(sm.dir, recycleName(id))
+		if err := sm.fs.Rename(path, recycled); err != nil {
+			return fmt.Errorf("failed to recycle segment: %w", err)
+		}
+		sm.recycled = append(sm.recycled, recycled)
+	} else if err := sm.fs.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove segment: %w", err)
+	}
+
+	return sm.syncDir()
+}
+
+func (sm *diskSegmentManager) Close() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.closed {
+		return nil
+	}
+	sm.closed = true
+
+	if err := sm.trim(); err != nil {
+		_ = sm.active.Close()
+		return err
+	}
+	if err := sm.sync(); err != nil {
+		_ = sm.active.Close()
+		return err
+	}
+
+	return sm.active.Close()
+}
+
+// countingWriter tracks the size of the active segment without asking the
+// file for its offset after every entry.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (sm *diskSegmentManager) syncDir() error {
+	if err := sm.fs.SyncDir(sm.dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+func recycleName(id int) string {
+	return fmt.Sprintf("%s%04d%s", recyclePrefix, id, segmentSuffix)
+}
+
+// loadRecycled returns the recycled segments, oldest first, deleting any
+// beyond the number WithRecycling keeps.
+func (sm *diskSegmentManager) loadRecycled() ([]string, error) {
+	dir, n := sm.dir, sm.opts.recycle
+	entries, err := sm.fs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recycled segments: %w", err)
+	}
+
+	var recycled []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, recyclePrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if len(recycled) >= n {
+			if err := sm.fs.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove recycled segment: %w", err)
+			}
+			continue
+		}
+		recycled = append(recycled, path)
+	}
+
+	return recycled, nil
+}
+
+// extend grows f to size bytes of zeros.
+func extend(f vfs.File, size int64) error {
+	return f.Truncate(size)
+}
+
+// refill zeroes f by truncating it and growing it back to size.
+func refill(f vfs.File, size int64) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Truncate(size)
+}
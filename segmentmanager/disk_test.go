@@ -0,0 +1,440 @@
+package segmentmanager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+func writeEntry(t *testing.T, sm SegmentManager, entry []byte) {
+	t.Helper()
+	err := sm.WriteActive(len(entry), func(w io.Writer) error {
+		_, err := w.Write(entry)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskSegmentManagerCreatesFirstSegment(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = sm.Close()
+	}()
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(segments) != 1 || segments[0].ID != 1 {
+		t.Fatalf("expected segment-0001.log, got %v", segments)
+	}
+}
+
+func TestDiskSegmentManagerRotates(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := [][]byte{
+		[]byte("aaaa"),
+		[]byte("bbbb"),
+		[]byte("cccc"),             // does not fit next to the first two
+		[]byte("dddddddddddddddd"), // larger than a whole segment
+		[]byte("e"),
+	}
+	for _, e := range entries {
+		writeEntry(t, sm, e)
+	}
+
+	if id, size := sm.Active(); id != 4 || size != 1 {
+		t.Fatalf("expected segment 4 of size 1 to be active, got %d of size %d", id, size)
+	}
+
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"aaaabbbb", "cccc", "dddddddddddddddd", "e"}
+	if len(segments) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(segments))
+	}
+
+	for i, s := range segments {
+		if s.ID != i+1 {
+			t.Fatalf("segment %d has id %d", i, s.ID)
+		}
+		data, err := os.ReadFile(s.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(want[i])) {
+			t.Fatalf("segment %d: got %q want %q", s.ID, data, want[i])
+		}
+	}
+}
+
+func TestDiskSegmentManagerReopenAppendsToNewest(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntry(t, sm, []byte("aaaaaa"))
+	writeEntry(t, sm, []byte("bb"))
+	writeEntry(t, sm, []byte("cc"))
+	_ = sm.Close()
+
+	sm, err = NewDiskSegmentManager(dir, WithMaxSegmentSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntry(t, sm, []byte("dd"))
+	writeEntry(t, sm, []byte("eeeeee"))
+	_ = sm.Close()
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"aaaaaabb", "ccdd", "eeeeee"}
+	if len(segments) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(segments))
+	}
+	for i, s := range segments {
+		data, _ := os.ReadFile(s.Path)
+		if string(data) != want[i] {
+			t.Fatalf("segment %d: got %q want %q", s.ID, data, want[i])
+		}
+	}
+}
+
+func TestDiskSegmentManagerClosed(t *testing.T) {
+	sm, err := NewDiskSegmentManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sm.Close()
+
+	err = sm.WriteActive(1, func(w io.Writer) error {
+		return nil
+	})
+	if err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestParseSegmentName(t *testing.T) {
+	tests := []struct {
+		name string
+		id   int
+		ok   bool
+	}{
+		{"segment-0001.log", 1, true},
+		{"segment-0042.log", 42, true},
+		{"segment-12345.log", 12345, true},
+		{"segment-0000.log", 0, false},
+		{"segment-abcd.log", 0, false},
+		{"WAL.log", 0, false},
+		{"segment-0001.idx", 0, false},
+	}
+
+	for _, tt := range tests {
+		id, ok := ParseSegmentName(tt.name)
+		if id != tt.id || ok != tt.ok {
+			t.Fatalf("%s: got (%d,%v) want (%d,%v)", tt.name, id, ok, tt.id, tt.ok)
+		}
+		if ok && SegmentName(id) != tt.name && id < 10000 {
+			t.Fatalf("SegmentName(%d) = %s", id, SegmentName(id))
+		}
+	}
+}
+
+func TestDiskSegmentManagerDiscardsFailedEntry(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEntry(t, sm, []byte("good"))
+
+	errBoom := errors.New("boom")
+	err = sm.WriteActive(8, func(w io.Writer) error {
+		_, _ = w.Write([]byte("par"))
+		return errBoom
+	})
+	if err != errBoom {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+
+	writeEntry(t, sm, []byte("next"))
+	_ = sm.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, SegmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "goodnext" {
+		t.Fatalf("got %q", data)
+	}
+}
+
+func TestDiskSegmentManagerWritesHeader(t *testing.T) {
+	dir := t.TempDir()
+	header := func(w io.Writer) error {
+		_, err := w.Write([]byte("HDR:"))
+		return err
+	}
+
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(10), WithSegmentHeader(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntry(t, sm, []byte("aaaa"))
+	writeEntry(t, sm, []byte("bbbbbbbbbbbb")) // larger than what is left
+	_ = sm.Close()
+
+	// Reopening a non-empty segment must not write a second header.
+	sm, err = NewDiskSegmentManager(dir, WithMaxSegmentSize(10), WithSegmentHeader(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sm.Close()
+
+	segments, _ := ListSegments(dir)
+	want := []string{"HDR:aaaa", "HDR:bbbbbbbbbbbb"}
+	if len(segments) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(segments))
+	}
+	for i, s := range segments {
+		data, _ := os.ReadFile(s.Path)
+		if string(data) != want[i] {
+			t.Fatalf("segment %d: got %q want %q", s.ID, data, want[i])
+		}
+	}
+}
+
+func TestDiskSegmentManagerRemove(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = sm.Close()
+	}()
+
+	for _, e := range []string{"aaaa", "bbbb", "cccc"} {
+		writeEntry(t, sm, []byte(e))
+	}
+
+	if err := sm.Remove(3); err != ErrActiveSegment {
+		t.Fatalf("expected ErrActiveSegment, got %v", err)
+	}
+	if err := sm.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := sm.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || segments[0].ID != 2 || segments[1].ID != 3 {
+		t.Fatalf("unexpected segments %v", segments)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestDiskSegmentManagerPreallocates(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(6000), WithPreallocation(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := filepath.Join(dir, SegmentName(1))
+	writeEntry(t, sm, []byte("aaaa"))
+	if size := fileSize(t, first); size != 4096 {
+		t.Fatalf("expected 4096 bytes reserved, got %d", size)
+	}
+
+	// The next chunk is capped at the segment size.
+	writeEntry(t, sm, bytes.Repeat([]byte("b"), 4096))
+	if size := fileSize(t, first); size != 6000 {
+		t.Fatalf("expected reservation capped at 6000 bytes, got %d", size)
+	}
+
+	// Rotating seals the first segment at the end of its entries.
+	writeEntry(t, sm, bytes.Repeat([]byte("c"), 4096))
+	if size := fileSize(t, first); size != 4100 {
+		t.Fatalf("sealed segment not trimmed: %d bytes", size)
+	}
+
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := fileSize(t, filepath.Join(dir, SegmentName(2))); size != 4096 {
+		t.Fatalf("closed segment not trimmed: %d bytes", size)
+	}
+}
+
+func TestDiskSegmentManagerRecycles(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(4), WithRecycling(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{"aaaa", "bbbb", "cccc"} {
+		writeEntry(t, sm, []byte(e))
+	}
+	before, err := os.Stat(filepath.Join(dir, SegmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sm.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	// The pool is full, so this one is deleted.
+	if err := sm.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, recycleName(2))); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected segment 2 to be deleted, got %v", err)
+	}
+
+	writeEntry(t, sm, []byte("dd"))
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, SegmentName(4))
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatal("segment 4 was not made from the recycled segment 1")
+	}
+	if _, err := os.Stat(filepath.Join(dir, recycleName(1))); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("recycled file still present: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "dd" {
+		t.Fatalf("recycled segment holds %q", data)
+	}
+}
+
+func TestDiskSegmentManagerReloadsRecycled(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewDiskSegmentManager(dir, WithMaxSegmentSize(4), WithRecycling(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"aaaa", "bbbb", "cccc"} {
+		writeEntry(t, sm, []byte(e))
+	}
+	for _, id := range []int{1, 2} {
+		if err := sm.Remove(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening with a smaller pool keeps the oldest and deletes the rest.
+	sm, err = NewDiskSegmentManager(dir, WithMaxSegmentSize(4), WithRecycling(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = sm.Close()
+	}()
+
+	if _, err := os.Stat(filepath.Join(dir, recycleName(1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, recycleName(2))); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected recycle-0002.log to be deleted, got %v", err)
+	}
+
+	writeEntry(t, sm, []byte("dddd"))
+	if _, err := os.Stat(filepath.Join(dir, recycleName(1))); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("recycled segment was not reused: %v", err)
+	}
+}
+
+func TestDiskSegmentManagerInMemory(t *testing.T) {
+	fsys := vfs.NewMem()
+	dir := "wal"
+	sm, err := NewDiskSegmentManager(dir, WithFS(fsys), WithMaxSegmentSize(8), WithPreallocation(8), WithRecycling(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []string{"aaaa", "bbbb", "cccc"} {
+		writeEntry(t, sm, []byte(e))
+	}
+	if err := sm.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	writeEntry(t, sm, []byte("dddddd"))
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("segments written to disk: %v", err)
+	}
+
+	segments, err := ListSegmentsFS(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{2: "cccc", 3: "dddddd"}
+	if len(segments) != len(want) {
+		t.Fatalf("expected segments 2 and 3, got %v", segments)
+	}
+	for _, s := range segments {
+		data, err := vfs.ReadFile(fsys, s.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[s.ID] {
+			t.Fatalf("segment %d: got %q want %q", s.ID, data, want[s.ID])
+		}
+	}
+}
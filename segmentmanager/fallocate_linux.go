@@ -0,0 +1,58 @@
+package segmentmanager
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// fallocZeroRange is FALLOC_FL_ZERO_RANGE, which the syscall package lacks.
+const fallocZeroRange = 0x10
+
+// fder is a File backed by a file descriptor, such as one from vfs.OS. Other
+// files get the portable fallbacks.
+type fder interface {
+	Fd() uintptr
+}
+
+// preallocate reserves the bytes [off, off+n) of f, extending it with zeros.
+func preallocate(f vfs.File, off, n int64) error {
+	fd, ok := f.(fder)
+	if !ok {
+		return extend(f, off+n)
+	}
+	err := syscall.Fallocate(int(fd.Fd()), 0, off, n)
+	if unsupported(err) {
+		return extend(f, off+n)
+	}
+	return err
+}
+
+// zeroFill replaces the first size bytes of f with zeros, keeping its blocks
+// allocated where the file system allows.
+func zeroFill(f vfs.File, size int64) error {
+	fd, ok := f.(fder)
+	if !ok {
+		return refill(f, size)
+	}
+	err := syscall.Fallocate(int(fd.Fd()), fallocZeroRange, 0, size)
+	if unsupported(err) {
+		return refill(f, size)
+	}
+	return err
+}
+
+// datasync flushes the data of f without metadata such as its modification
+// time, which preallocation keeps from changing anything else.
+func datasync(f vfs.File) error {
+	fd, ok := f.(fder)
+	if !ok {
+		return f.Sync()
+	}
+	return syscall.Fdatasync(int(fd.Fd()))
+}
+
+func unsupported(err error) bool {
+	return errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS)
+}
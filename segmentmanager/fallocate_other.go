@@ -0,0 +1,17 @@
+//go:build !linux
+
+package segmentmanager
+
+import "github.com/Priyanshu23/FlashLogGo/vfs"
+
+func preallocate(f vfs.File, off, n int64) error {
+	return extend(f, off+n)
+}
+
+func zeroFill(f vfs.File, size int64) error {
+	return refill(f, size)
+}
+
+func datasync(f vfs.File) error {
+	return f.Sync()
+}
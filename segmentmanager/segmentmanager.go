@@ -0,0 +1,157 @@
+// Package segmentmanager splits an append-only log into numbered segment files
+// (segment-0001.log, segment-0002.log, ...) and rotates to a fresh segment once
+// the active one reaches its size limit.
+package segmentmanager
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+const (
+	DefaultMaxSegmentSize = 16 << 20 // 16MB
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+
+	// Removed segments kept for reuse by WithRecycling are renamed to
+	// recycle-0001.log and so on, which ListSegments does not pick up.
+	recyclePrefix = "recycle-"
+)
+
+type SegmentManager interface {
+	// WriteActive hands the active segment to fn so it can append an entry of
+	// entrySize bytes. If the entry would push the active segment past its size
+	// limit, the segment is sealed and a new one is started first. If fn fails,
+	// anything it wrote is discarded.
+	WriteActive(entrySize int, fn func(w io.Writer) error) error
+	// Active returns the id and size of the active segment, so the end of the
+	// last entry written.
+	Active() (id int, size int64)
+	// Sync flushes the active segment to stable storage.
+	Sync() error
+	// Segments lists every segment, oldest first. The last one is active.
+	Segments() ([]Segment, error)
+	// Remove deletes a sealed segment. The active segment cannot be removed.
+	Remove(id int) error
+	Close() error
+}
+
+// Segment identifies a single segment file on disk.
+type Segment struct {
+	ID   int
+	Path string
+}
+
+type options struct {
+	maxSegmentSize int64
+	header         func(w io.Writer) error
+	preallocate    int64
+	recycle        int
+	fs             vfs.FS
+}
+
+type Option func(*options)
+
+// WithMaxSegmentSize sets the size in bytes after which the active segment is
+// rotated.
+func WithMaxSegmentSize(size int64) Option {
+	return func(o *options) {
+		o.maxSegmentSize = size
+	}
+}
+
+// WithSegmentHeader registers fn to write a header at the start of every new
+// segment, including an empty segment left behind by a crash.
+func WithSegmentHeader(fn func(w io.Writer) error) Option {
+	return func(o *options) {
+		o.header = fn
+	}
+}
+
+// WithPreallocation reserves space for the active segment in chunks of size
+// bytes ahead of the entries that fill it, so appends do not change the file
+// size and syncs can leave the metadata alone. Reserved space reads as zeros.
+// It is cut off when a segment is sealed or closed, but a crash leaves it
+// behind, and reopening appends after it; callers that preallocate must trim
+// the active segment to its last entry before opening it again.
+func WithPreallocation(size int64) Option {
+	return func(o *options) {
+		o.preallocate = size
+	}
+}
+
+// WithRecycling keeps up to n removed segments around and reuses them for new
+// segments instead of creating files from scratch. A recycled segment is
+// zero-filled, keeping its space reserved where the file system allows, and
+// renamed. Since the file is reused in place, a reader still working through
+// a segment when it is removed may see whatever is written to it next.
+func WithRecycling(n int) Option {
+	return func(o *options) {
+		o.recycle = n
+	}
+}
+
+// WithFS stores the segments in fsys instead of the operating system's file
+// system.
+func WithFS(fsys vfs.FS) Option {
+	return func(o *options) {
+		o.fs = fsys
+	}
+}
+
+// SegmentName returns the file name of the segment with the given id.
+func SegmentName(id int) string {
+	return fmt.Sprintf("%s%04d%s", segmentPrefix, id, segmentSuffix)
+}
+
+// ParseSegmentName extracts the segment id from a segment file name.
+func ParseSegmentName(name string) (int, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(name[len(segmentPrefix) : len(name)-len(segmentSuffix)])
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// ListSegments returns the segments in dir ordered by id.
+func ListSegments(dir string) ([]Segment, error) {
+	return ListSegmentsFS(vfs.OS(), dir)
+}
+
+// ListSegmentsFS is ListSegments for a directory in fsys.
+func ListSegmentsFS(fsys vfs.FS, dir string) ([]Segment, error) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		id, ok := ParseSegmentName(e.Name())
+		if !ok {
+			continue
+		}
+		segments = append(segments, Segment{ID: id, Path: filepath.Join(dir, e.Name())})
+	}
+
+	slices.SortFunc(segments, func(a, b Segment) int {
+		return a.ID - b.ID
+	})
+
+	return segments, nil
+}
@@ -32,7 +32,7 @@
 //	  24 │|  | Bloom filter bits     |  <- Fast "key not present" check      |
 //	  25 │|  +-----------------------+                                       |
 //	  26 │+------------------------------------------------------------------+
-//	  27 │|  FOOTER (fixed 48 bytes)                                         |
+//	  27 │|  FOOTER (49 bytes + keys)                                        |
 //	  28 │|  +-----------------------+                                       |
 //	  29 │|  | Index offset     (8)  |                                       |
 //	  30 │|  | Index size       (4)  |                                       |
@@ -42,9 +42,16 @@
 //	  34 │|  | Min key size     (2)  |                                       |
 //	  35 │|  | Max key offset   (8)  |                                       |
 //	  36 │|  | Max key size     (2)  |                                       |
-//	  37 │|  | CRC32            (4)  |                                       |
-//	  38 │|  +-----------------------+                                       |
-//	  39 │+------------------------------------------------------------------+
+//	  37 │|  | Min key, max key      |                                       |
+//	  38 │|  | Checksum algo    (1)  |  <- checksum.Algorithm of the file    |
+//	  39 │|  | Checksum         (4)  |                                       |
+//	  40 │|  +-----------------------+                                       |
+//	  41 │+------------------------------------------------------------------+
+//
+//	Every checksum in the file uses the algorithm named by the byte in front
+//	of the footer checksum, so readers should look it up before verifying
+//	anything. The footer checksum covers that byte too: if it is damaged, the
+//	footer is verified with the wrong algorithm and fails.
 //
 //	---
 //
@@ -65,7 +72,7 @@
 //	  11 │+---------------------------------------------------------------+
 //	  12 │| Restart Points (for prefix compression, optional v2)          |
 //	  13 │+---------------------------------------------------------------+
-//	  14 │| Block CRC32 (4 bytes)                                         |
+//	  14 │| Block Checksum (4 bytes)                                      |
 //	  15 │+---------------------------------------------------------------+
 //
 //
@@ -93,7 +100,7 @@
 //	   7 │+---------------------------------------------------------------+
 //	   8 │| Entry 1: ...                                                  |
 //	   9 │+---------------------------------------------------------------+
-//	  10 │| Index CRC32 (4 bytes)                                         |
+//	  10 │| Index Checksum (4 bytes)                                      |
 //	  11 │+---------------------------------------------------------------+
 //
 //	---
@@ -106,7 +113,7 @@
 //	   3 │| Num Hash Functions (4 byte)                                   |
 //	   4 │| Bit Array Size (4 bytes)                                      |
 //	   5 │| Bit Array (variable)                                          |
-//	   6 │| CRC32 (4 bytes)                                               |
+//	   6 │| Checksum (4 bytes)                                            |
 //	   7 │+---------------------------------------------------------------+
 package sst
 
@@ -114,12 +121,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"hash/crc32"
 	"io"
-	"os"
 	"path/filepath"
 
+	"github.com/Priyanshu23/FlashLogGo/checksum"
 	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
 	"github.com/bits-and-blooms/bloom/v3"
 )
 
@@ -142,11 +149,35 @@ type diskSSTWriter struct {
 	currDataBlockSize int
 	maxDataBlockSize  int
 	currDataBlock     dataBlock
-	sstFile           *os.File
+	sstFile           vfs.File
 	index             indexBlock
 	minKey            []byte
 	maxKey            []byte
 	bloomFilter       *bloom.BloomFilter
+	checksum          checksum.Algorithm
+}
+
+type options struct {
+	checksum checksum.Algorithm
+	fs       vfs.FS
+}
+
+type Option func(*options)
+
+// WithChecksum sets the algorithm the file's blocks and footer are
+// checksummed with. The default is checksum.CRC32IEEE.
+func WithChecksum(a checksum.Algorithm) Option {
+	return func(o *options) {
+		o.checksum = a
+	}
+}
+
+// WithFS writes the file to fsys instead of the operating system's file
+// system.
+func WithFS(fsys vfs.FS) Option {
+	return func(o *options) {
+		o.fs = fsys
+	}
 }
 
 type dataEntry struct {
@@ -199,8 +230,16 @@ type File struct {
 	footer     footer
 }
 
-func NewDiskSSTWriter(dir string) (SSTWriter, error) {
-	file, err := os.Create(filepath.Join(dir, filename))
+func NewDiskSSTWriter(dir string, opts ...Option) (SSTWriter, error) {
+	o := options{checksum: checksum.Default, fs: vfs.OS()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.checksum.Validate(); err != nil {
+		return nil, err
+	}
+
+	file, err := vfs.Create(o.fs, filepath.Join(dir, filename))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SST file: %w", err)
 	}
@@ -213,6 +252,7 @@ func NewDiskSSTWriter(dir string) (SSTWriter, error) {
 		maxDataBlockSize:  defaultMaxDataBlockSize,
 		sstFile:           file,
 		bloomFilter:       filter,
+		checksum:          o.checksum,
 	}, nil
 }
 
@@ -238,7 +278,7 @@ func (d *diskSSTWriter) appendDataBlock() error {
 
 	_ = binary.Write(d.sstFile, binary.LittleEndian, uint32(0))
 
-	crc := crc32.NewIEEE()
+	crc := d.checksum.New()
 	mw := io.MultiWriter(d.sstFile, crc)
 
 	for _, e := range d.currDataBlock.entries {
@@ -310,7 +350,7 @@ func (d *diskSSTWriter) Write(
 func (d *diskSSTWriter) writeIndexBlock() (int64, uint32, error) {
 	start, _ := d.sstFile.Seek(0, io.SeekCurrent)
 
-	crc := crc32.NewIEEE()
+	crc := d.checksum.New()
 	mw := io.MultiWriter(d.sstFile, crc)
 
 	_ = binary.Write(mw, binary.LittleEndian, uint32(len(d.index.entries)))
@@ -334,7 +374,7 @@ func (d *diskSSTWriter) writeBloomFilter() (int64, uint32, error) {
 		return 0, 0, fmt.Errorf("failed to seek start of file: %w", err)
 	}
 
-	crc := crc32.NewIEEE()
+	crc := d.checksum.New()
 	mw := io.MultiWriter(d.sstFile, crc)
 
 	err = binary.Write(mw, binary.LittleEndian, uint32(d.bloomFilter.K()))
@@ -368,7 +408,7 @@ func (d *diskSSTWriter) writeBloomFilter() (int64, uint32, error) {
 func (d *diskSSTWriter) writeFooter(indexOffset int64, indexSize uint32, bloomFilterOffset int64, bloomFilterSize uint32) error {
 	footerStart, _ := d.sstFile.Seek(0, io.SeekCurrent)
 
-	crc := crc32.NewIEEE()
+	crc := d.checksum.New()
 	mw := io.MultiWriter(d.sstFile, crc)
 
 	// Index location
@@ -386,7 +426,7 @@ func (d *diskSSTWriter) writeFooter(indexOffset int64, indexSize uint32, bloomFi
 	}
 
 	// Min key
-	minKeyOffset := footerStart + 8 + 4 + 8 + 2 + 8 + 2
+	minKeyOffset := footerStart + 8 + 4 + 8 + 4 + 8 + 2 + 8 + 2
 	_ = binary.Write(mw, binary.LittleEndian, minKeyOffset)
 	_ = binary.Write(mw, binary.LittleEndian, uint16(len(d.minKey)))
 
@@ -399,8 +439,15 @@ func (d *diskSSTWriter) writeFooter(indexOffset int64, indexSize uint32, bloomFi
 	_, _ = mw.Write(d.minKey)
 	_, _ = mw.Write(d.maxKey)
 
+	// Checksum algorithm, just before the CRC so readers can find it
+	if err := binary.Write(mw, binary.LittleEndian, uint8(d.checksum)); err != nil {
+		return fmt.Errorf("failed to write checksum algorithm: %w", err)
+	}
+
 	// CRC
-	_ = binary.Write(d.sstFile, binary.LittleEndian, crc.Sum32())
+	if err := binary.Write(d.sstFile, binary.LittleEndian, crc.Sum32()); err != nil {
+		return fmt.Errorf("failed to write footer checksum: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,159 @@
+package sst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+var algorithms = []checksum.Algorithm{checksum.CRC32IEEE, checksum.CRC32C, checksum.XXHash64}
+
+// writeSST writes n entries, spread over several data blocks, and returns the
+// file and the size of its footer.
+func writeSST(t *testing.T, a checksum.Algorithm, n int) ([]byte, int) {
+	t.Helper()
+	fsys := vfs.NewMem()
+	if err := fsys.MkdirAll("/sst", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewDiskSSTWriter("/sst", WithChecksum(a), WithFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		if err := w.Write(types.OperationPut, fmt.Appendf(nil, "key-%04d", i), bytes.Repeat([]byte("v"), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := vfs.ReadFile(fsys, filepath.Join("/sst", filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, 49 + 2*len("key-0000")
+}
+
+// parsedSST is what parseSST read back from a file.
+type parsedSST struct {
+	sum            checksum.Algorithm
+	keys           []string
+	minKey, maxKey string
+}
+
+// parseSST reads data the way a reader would, verifying every checksum with
+// the algorithm the footer names.
+func parseSST(data []byte, footerSize int) (parsedSST, error) {
+	le := binary.LittleEndian
+	footer := data[len(data)-footerSize:]
+	body := footer[:len(footer)-4]
+
+	p := parsedSST{sum: checksum.Algorithm(body[len(body)-1])}
+	if err := p.sum.Validate(); err != nil {
+		return parsedSST{}, err
+	}
+
+	// verify checks the checksum at the end of b and returns what it covers.
+	verify := func(what string, b []byte) ([]byte, error) {
+		covered := b[:len(b)-4]
+		if p.sum.Checksum(covered) != le.Uint32(b[len(b)-4:]) {
+			return nil, fmt.Errorf("%s checksum mismatch", what)
+		}
+		return covered, nil
+	}
+
+	if _, err := verify("footer", footer); err != nil {
+		return parsedSST{}, err
+	}
+	indexOffset, indexSize := le.Uint64(footer), le.Uint32(footer[8:])
+	bloomOffset, bloomSize := le.Uint64(footer[12:]), le.Uint32(footer[20:])
+	minOffset, minSize := le.Uint64(footer[24:]), le.Uint16(footer[32:])
+	maxOffset, maxSize := le.Uint64(footer[34:]), le.Uint16(footer[42:])
+	p.minKey = string(data[minOffset : minOffset+uint64(minSize)])
+	p.maxKey = string(data[maxOffset : maxOffset+uint64(maxSize)])
+
+	if _, err := verify("bloom filter", data[bloomOffset:bloomOffset+uint64(bloomSize)]); err != nil {
+		return parsedSST{}, err
+	}
+
+	index, err := verify("index", data[indexOffset:indexOffset+uint64(indexSize)])
+	if err != nil {
+		return parsedSST{}, err
+	}
+	for n, off := le.Uint32(index), 4; n > 0; n-- {
+		off += 4 + int(le.Uint32(index[off:]))
+		blockOffset, blockSize := le.Uint64(index[off:]), le.Uint32(index[off+8:])
+		off += 12
+
+		// | payload size (4) | payload | checksum (4) |
+		block, err := verify("data block", data[blockOffset+4:blockOffset+4+uint64(blockSize)])
+		if err != nil {
+			return parsedSST{}, err
+		}
+		for len(block) > 0 {
+			keyLen, valLen := le.Uint32(block), le.Uint32(block[4:])
+			p.keys = append(p.keys, string(block[9:9+keyLen]))
+			block = block[9+keyLen+valLen:]
+		}
+	}
+
+	return p, nil
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.String(), func(t *testing.T) {
+			data, footerSize := writeSST(t, a, 200)
+
+			p, err := parseSST(data, footerSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.sum != a {
+				t.Fatalf("footer names %v", p.sum)
+			}
+			if len(p.keys) != 200 || p.keys[0] != "key-0000" || p.keys[199] != "key-0199" {
+				t.Fatalf("read back %d keys", len(p.keys))
+			}
+			if p.minKey != "key-0000" || p.maxKey != "key-0199" {
+				t.Fatalf("key range %q to %q", p.minKey, p.maxKey)
+			}
+		})
+	}
+}
+
+func TestChecksumDetectsFooterDamage(t *testing.T) {
+	for _, a := range algorithms {
+		t.Run(a.String(), func(t *testing.T) {
+			tests := []struct {
+				name    string
+				corrupt func(footer []byte)
+			}{
+				{"index offset", func(f []byte) { f[0] ^= 0xFF }},
+				// Another valid algorithm, so only the checksum can tell.
+				{"algorithm", func(f []byte) { f[len(f)-5] = byte(algorithms[int(a)%len(algorithms)]) }},
+				{"checksum", func(f []byte) { f[len(f)-1] ^= 0xFF }},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					data, footerSize := writeSST(t, a, 10)
+					tt.corrupt(data[len(data)-footerSize:])
+
+					if _, err := parseSST(data, footerSize); err == nil {
+						t.Fatal("damaged footer verified")
+					}
+				})
+			}
+		})
+	}
+}
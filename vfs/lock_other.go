@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockFile fails where neither flock nor LockFileEx is available, rather than
+// hand out a lock that is not enforced.
+func lockFile(f *os.File) error {
+	return fmt.Errorf("failed to lock %s: %w", f.Name(), errors.ErrUnsupported)
+}
@@ -0,0 +1,447 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memFS keeps every file in memory. Paths are cleaned with filepath.Clean, so
+// "dir/../x" and "x" name the same file; the root and "." always exist.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+	dirs  map[string]time.Time // directory to creation time
+	locks map[string]bool
+}
+
+// memNode is the content of a file, shared by every handle open on it. A
+// file removed or renamed while open stays readable through its handles.
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	perm    fs.FileMode
+	modTime time.Time
+}
+
+// NewMem returns an empty file system held in memory. Syncs do nothing and
+// nothing survives the process, which suits tests that should not touch the
+// disk.
+func NewMem() FS {
+	return &memFS{
+		files: make(map[string]*memNode),
+		dirs:  make(map[string]time.Time),
+		locks: make(map[string]bool),
+	}
+}
+
+func (m *memFS) isDir(name string) bool {
+	if name == "." || name == string(filepath.Separator) {
+		return true
+	}
+	_, ok := m.dirs[name]
+	return ok
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	given := name
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	node, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if !m.isDir(filepath.Dir(name)) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		node = &memNode{perm: perm.Perm(), modTime: time.Now()}
+		m.files[name] = node
+	}
+
+	f := &memFile{name: given, node: node, flag: flag}
+	if flag&os.O_TRUNC != 0 && f.writable() {
+		node.mu.Lock()
+		node.data = node.data[:0]
+		node.modTime = time.Now()
+		node.mu.Unlock()
+	}
+
+	return f, nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if m.isDir(newpath) || !m.isDir(filepath.Dir(newpath)) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrInvalid}
+	}
+
+	delete(m.files, oldpath)
+	m.files[newpath] = node
+
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if _, ok := m.dirs[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(m.children(name)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+	}
+	delete(m.dirs, name)
+
+	return nil
+}
+
+func (m *memFS) MkdirAll(path string, perm fs.FileMode) error {
+	path = filepath.Clean(path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir := path; !m.isDir(dir); dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+		m.dirs[dir] = time.Now()
+	}
+
+	return nil
+}
+
+// children returns the names of the files and directories directly in dir.
+func (m *memFS) children(dir string) []string {
+	var names []string
+	for p := range m.files {
+		if filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	for p := range m.dirs {
+		if p != dir && filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isDir(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for _, child := range m.children(name) {
+		info, _ := m.stat(filepath.Join(name, child))
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	return entries, nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, ok := m.stat(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+func (m *memFS) stat(name string) (fs.FileInfo, bool) {
+	if node, ok := m.files[name]; ok {
+		return node.info(name), true
+	}
+	if m.isDir(name) {
+		return &memInfo{name: filepath.Base(name), mode: fs.ModeDir | 0o755, modTime: m.dirs[name]}, true
+	}
+	return nil, false
+}
+
+func (m *memFS) SyncDir(name string) error {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isDir(name) {
+		return &fs.PathError{Op: "sync", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (m *memFS) Lock(name string) (io.Closer, error) {
+	f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.locks[name] {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrLocked}
+	}
+	m.locks[name] = true
+
+	return &memLock{fs: m, name: name}, nil
+}
+
+type memLock struct {
+	fs   *memFS
+	name string
+	once sync.Once
+}
+
+func (l *memLock) Close() error {
+	l.once.Do(func() {
+		l.fs.mu.Lock()
+		defer l.fs.mu.Unlock()
+		delete(l.fs.locks, l.name)
+	})
+	return nil
+}
+
+func (n *memNode) info(name string) *memInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return &memInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: n.perm, modTime: n.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// memFile is a handle on a memNode with its own offset. Its name is the one
+// it was opened with, as for *os.File.
+type memFile struct {
+	name   string
+	node   *memNode
+	flag   int
+	mu     sync.Mutex
+	off    int64
+	closed bool
+}
+
+func (f *memFile) readable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *memFile) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+// check returns the error for op on f if it is closed or not open for it.
+func (f *memFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if !allowed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("read", f.readable()); err != nil {
+		return 0, err
+	}
+	n, err := f.node.readAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	err := f.check("read", f.readable())
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.node.readAt(p, off)
+}
+
+func (n *memNode) readAt(p []byte, off int64) (int, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if off >= int64(len(n.data)) {
+		return 0, io.EOF
+	}
+	c := copy(p, n.data[off:])
+	if c < len(p) {
+		return c, io.EOF
+	}
+	return c, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("write", f.writable()); err != nil {
+		return 0, err
+	}
+
+	n := f.node
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(n.data))
+	}
+	end := f.off + int64(len(p))
+	if end > int64(len(n.data)) {
+		n.data = append(n.data, make([]byte, end-int64(len(n.data)))...)
+	}
+	copy(n.data[f.off:], p)
+	f.off = end
+	n.modTime = time.Now()
+
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		f.node.mu.RLock()
+		offset += int64(len(f.node.data))
+		f.node.mu.RUnlock()
+	}
+	if offset < 0 || whence < io.SeekStart || whence > io.SeekEnd {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+
+	return offset, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.check("sync", true)
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("truncate", f.writable()); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	n := f.node
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.modTime = time.Now()
+
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+
+	return nil
+}
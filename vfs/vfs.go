@@ -0,0 +1,75 @@
+// Package vfs abstracts the file system the WAL, its segments and SST files
+// are stored in. Storage code opens, creates, renames, removes, syncs, lists
+// and locks files only through an FS, so it runs unchanged on the operating
+// system (OS), in memory (NewMem), or on a wrapper that instruments or
+// transforms the files of another FS.
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+var ErrLocked = fmt.Errorf("file is locked")
+
+// File is an open file. Its methods behave like those of *os.File.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS is a file system. Errors for missing or existing files match
+// fs.ErrNotExist and fs.ErrExist, as with the os package.
+type FS interface {
+	// OpenFile opens the named file with the os.O_* flags given, creating it
+	// with perm if os.O_CREATE is among them.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	// Rename moves a file, replacing whatever is at newpath.
+	Rename(oldpath, newpath string) error
+	// Remove deletes a file or an empty directory.
+	Remove(name string) error
+	// MkdirAll creates a directory and any parents it is missing.
+	MkdirAll(path string, perm fs.FileMode) error
+	// ReadDir lists a directory, sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	// SyncDir makes the entries of a directory durable, so files created,
+	// renamed or removed in it survive a crash.
+	SyncDir(name string) error
+	// Lock creates the named file if needed and takes an exclusive lock on
+	// it, held until the returned Closer is closed. It fails with ErrLocked
+	// if the lock is already held.
+	Lock(name string) (io.Closer, error)
+}
+
+// Open opens the named file for reading.
+func Open(fsys FS, name string) (File, error) {
+	return fsys.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the named file for reading and writing.
+func Create(fsys FS, name string) (File, error) {
+	return fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// ReadFile returns the contents of the named file.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := Open(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return io.ReadAll(f)
+}
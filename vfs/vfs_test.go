@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// filesystems returns every implementation, each with an empty directory to
+// work in.
+func filesystems(t *testing.T) []struct {
+	name string
+	fs   FS
+	dir  string
+} {
+	return []struct {
+		name string
+		fs   FS
+		dir  string
+	}{
+		{"os", OS(), t.TempDir()},
+		{"mem", NewMem(), "/data"},
+	}
+}
+
+func TestFileReadWrite(t *testing.T) {
+	for _, tt := range filesystems(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fs.MkdirAll(tt.dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(tt.dir, "f")
+
+			f, err := Create(tt.fs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte("hello world")); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Truncate(5); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Seek(7, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			// Writing past the end leaves a gap of zeros.
+			if _, err := f.Write([]byte("!")); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ReadFile(tt.fs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "hello\x00\x00!" {
+				t.Fatalf("read %q", data)
+			}
+
+			f, err = Open(tt.fs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			buf := make([]byte, 4)
+			if n, err := f.ReadAt(buf, 6); n != 2 || err != io.EOF || string(buf[:n]) != "\x00!" {
+				t.Fatalf("ReadAt returned %d %v %q", n, err, buf[:n])
+			}
+			if _, err := f.Write([]byte("x")); err == nil {
+				t.Fatal("wrote to a file opened for reading")
+			}
+			info, err := f.Stat()
+			if err != nil || info.Size() != 8 || info.Name() != "f" {
+				t.Fatalf("Stat returned %v %v", info, err)
+			}
+		})
+	}
+}
+
+func TestDirectoryOperations(t *testing.T) {
+	for _, tt := range filesystems(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(tt.dir, "a", "b")
+			if err := tt.fs.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"y", "x"} {
+				f, err := Create(tt.fs, filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = f.Close()
+			}
+
+			if _, err := tt.fs.OpenFile(filepath.Join(dir, "x"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644); !errors.Is(err, fs.ErrExist) {
+				t.Fatalf("expected fs.ErrExist, got %v", err)
+			}
+			if _, err := Open(tt.fs, filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected fs.ErrNotExist, got %v", err)
+			}
+			if _, err := Create(tt.fs, filepath.Join(tt.dir, "missing", "f")); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected fs.ErrNotExist creating in a missing directory, got %v", err)
+			}
+
+			if err := tt.fs.Rename(filepath.Join(dir, "y"), filepath.Join(dir, "z")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.fs.Remove(filepath.Join(dir, "x")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.fs.SyncDir(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := tt.fs.ReadDir(filepath.Join(tt.dir, "a"))
+			if err != nil || len(entries) != 1 || entries[0].Name() != "b" || !entries[0].IsDir() {
+				t.Fatalf("ReadDir returned %v %v", entries, err)
+			}
+			entries, err = tt.fs.ReadDir(dir)
+			if err != nil || len(entries) != 1 || entries[0].Name() != "z" {
+				t.Fatalf("ReadDir returned %v %v", entries, err)
+			}
+			if _, err := tt.fs.Stat(filepath.Join(dir, "y")); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected the renamed file to be gone, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	for _, tt := range filesystems(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fs.MkdirAll(tt.dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(tt.dir, "LOCK")
+
+			l, err := tt.fs.Lock(path)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip("file locks are not supported on this platform")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tt.fs.Lock(path); !errors.Is(err, ErrLocked) {
+				t.Fatalf("expected ErrLocked, got %v", err)
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err = tt.fs.Lock(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = l.Close()
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// An archive directory holds the segments WithArchive moved out of the log,
+// compressed or not, and a manifest listing them in id order. The manifest is
+// replaced atomically after each segment is archived, so a segment is either
+// listed and complete or not in the archive at all.
+
+// ArchiveManifestPath is the manifest of an archive directory.
+const ArchiveManifestPath = "manifest.json"
+
+// archiveSuffix marks a compressed segment in the archive.
+const archiveSuffix = ".z"
+
+var ErrIncompleteArchive = fmt.Errorf("WAL archive does not cover the restore")
+
+// ArchivedSegment describes a segment in an archive.
+type ArchivedSegment struct {
+	ID    int    `json:"id"`
+	File  string `json:"file"`
+	Codec byte   `json:"codec,omitempty"` // 0 if stored uncompressed
+	Size  int64  `json:"size"`            // uncompressed size
+
+	FirstLSN uint64 `json:"first_lsn"`
+	LastLSN  uint64 `json:"last_lsn"`
+
+	// Start and End bound the time the segment's records were written: the
+	// oldest and newest record timestamps, see WithClock. For records without
+	// timestamps, End is when the segment was last written to and Start is
+	// the End of the segment before it, or zero if that is not known.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type archiveManifest struct {
+	Segments []ArchivedSegment `json:"segments"`
+}
+
+// WithArchive moves checkpointed segments into dir instead of deleting them,
+// compressed with c unless c is nil, and lists them in dir's manifest, see
+// ReadArchiveManifest and Restore. dir must not be the WAL directory.
+func WithArchive(dir string, c Codec) Option {
+	return func(cfg *config) {
+		cfg.archiveDir = dir
+		cfg.archiveCodec = c
+	}
+}
+
+// ReadArchiveManifest returns the segments in the archive at dir, oldest
+// first. An archive nothing has been moved to yet is empty.
+func ReadArchiveManifest(dir string) ([]ArchivedSegment, error) {
+	return ReadArchiveManifestFS(vfs.OS(), dir)
+}
+
+// ReadArchiveManifestFS is ReadArchiveManifest for an archive in fsys.
+func ReadArchiveManifestFS(fsys vfs.FS, dir string) ([]ArchivedSegment, error) {
+	data, err := vfs.ReadFile(fsys, filepath.Join(dir, ArchiveManifestPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest: %w", err)
+	}
+
+	var m archiveManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("archive manifest: %w: %w", ErrCorruptWAL, err)
+	}
+
+	return m.Segments, nil
+}
+
+// writeArchiveManifest atomically replaces the manifest in dir.
+func writeArchiveManifest(fsys vfs.FS, dir string, segments []ArchivedSegment) error {
+	data, err := json.MarshalIndent(archiveManifest{Segments: segments}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive manifest: %w", err)
+	}
+	return writeFileAtomic(fsys, dir, ArchiveManifestPath, data)
+}
+
+// archive copies the sealed segment s into the archive and lists it in the
+// manifest. Archiving a segment again, after a crash before it was removed,
+// replaces the earlier copy. The legacy WAL.log is archived as segment 0.
+func (w *WALWriter) archive(s segmentmanager.Segment) error {
+	fsys := w.cfg.fs
+	info, err := fsys.Stat(s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to archive segment: %w", err)
+	}
+	data, err := vfs.ReadFile(fsys, s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to archive segment: %w", err)
+	}
+
+	rg, err := scanRange(fsys, s.Path, w.enc.keys)
+	if err != nil {
+		return fmt.Errorf("failed to archive segment: %w", err)
+	}
+
+	a := ArchivedSegment{
+		ID:       s.ID,
+		File:     archiveName(s.ID),
+		Size:     int64(len(data)),
+		FirstLSN: rg.firstLSN,
+		LastLSN:  rg.lastLSN,
+		End:      info.ModTime().UTC(),
+	}
+	if rg.lastTime != 0 {
+		a.Start = time.Unix(0, rg.firstTime).UTC()
+		a.End = time.Unix(0, rg.lastTime).UTC()
+	}
+	if c := w.cfg.archiveCodec; c != nil {
+		if data, err = c.Compress(nil, data); err != nil {
+			return fmt.Errorf("failed to compress archived segment: %w", err)
+		}
+		a.Codec, a.File = c.ID(), a.File+archiveSuffix
+	}
+
+	dir := w.cfg.archiveDir
+	if err := writeFileAtomic(fsys, dir, a.File, data); err != nil {
+		return err
+	}
+
+	segments, err := ReadArchiveManifestFS(fsys, dir)
+	if err != nil {
+		return err
+	}
+	segments = slices.DeleteFunc(segments, func(e ArchivedSegment) bool {
+		return e.ID == s.ID
+	})
+	if n := len(segments); n > 0 && segments[n-1].ID < s.ID && a.Start.IsZero() {
+		a.Start = segments[n-1].End
+	}
+	segments = append(segments, a)
+	slices.SortFunc(segments, func(a, b ArchivedSegment) int {
+		return a.ID - b.ID
+	})
+
+	return writeArchiveManifest(fsys, dir, segments)
+}
+
+// archiveName is the name of segment id in the archive, before compression.
+func archiveName(id int) string {
+	if id == 0 {
+		return WalFilePath
+	}
+	return segmentmanager.SegmentName(id)
+}
+
+// newFileReader returns a reader over the single log file at path in fsys.
+func newFileReader(fsys vfs.FS, path string, keys *keyring, mode RecoveryMode) (*WALReader, error) {
+	r := &WALReader{
+		dir:     filepath.Dir(path),
+		handles: newFileSet(fsys),
+		files:   []string{path},
+		keys:    keys,
+		report:  RecoveryReport{Mode: mode},
+	}
+	r.cfg.recoveryMode = mode
+	r.cfg.fs = fsys
+
+	if err := r.open(0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// fileRange spans the records of a log file. The times are zero if no record
+// carries a timestamp.
+type fileRange struct {
+	firstLSN, lastLSN   uint64
+	firstTime, lastTime int64
+}
+
+// scanRange returns the LSNs of the first and last records of the log file at
+// path, and the oldest and newest timestamps among them, up to the first
+// damage.
+func scanRange(fsys vfs.FS, path string, keys *keyring) (fileRange, error) {
+	var rg fileRange
+	r, err := newFileReader(fsys, path, keys, PointInTime)
+	if err != nil {
+		return rg, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			return rg, nil
+		}
+		if err != nil {
+			return fileRange{}, err
+		}
+		if rg.firstLSN == 0 {
+			rg.firstLSN = l.LSN()
+		}
+		rg.lastLSN = max(rg.lastLSN, l.LSN())
+		if l.ts != 0 {
+			if rg.firstTime == 0 || l.ts < rg.firstTime {
+				rg.firstTime = l.ts
+			}
+			rg.lastTime = max(rg.lastTime, l.ts)
+		}
+	}
+}
+
+type restoreConfig struct {
+	snapshotLSN uint64
+	targetLSN   uint64
+	targetTime  time.Time
+	walDir      string
+	keys        KeyProvider
+	fs          vfs.FS
+}
+
+type RestoreOption func(*restoreConfig)
+
+// WithSnapshotLSN restores on top of a base snapshot holding every record up
+// to and including lsn, such as a flushed SST, so only later records are
+// replayed.
+func WithSnapshotLSN(lsn uint64) RestoreOption {
+	return func(c *restoreConfig) {
+		c.snapshotLSN = lsn
+	}
+}
+
+// WithTargetLSN stops the restore after the record with LSN lsn.
+func WithTargetLSN(lsn uint64) RestoreOption {
+	return func(c *restoreConfig) {
+		c.targetLSN = lsn
+	}
+}
+
+// WithTargetTime restores the log as of t, stopping before the first record
+// stamped after t, see WithClock. A record without a timestamp counts as
+// written when its segment was last written to, so among those the restore
+// stops at the end of the last segment that was finished by t.
+func WithTargetTime(t time.Time) RestoreOption {
+	return func(c *restoreConfig) {
+		c.targetTime = t
+	}
+}
+
+// WithRestoreWAL carries the restore on past the archive into the segments
+// still in the WAL directory dir.
+func WithRestoreWAL(dir string) RestoreOption {
+	return func(c *restoreConfig) {
+		c.walDir = dir
+	}
+}
+
+// WithRestoreKeys opens encrypted records with keys from kp.
+func WithRestoreKeys(kp KeyProvider) RestoreOption {
+	return func(c *restoreConfig) {
+		c.keys = kp
+	}
+}
+
+// WithRestoreFS reads the archive, and the WAL directory, from fsys instead
+// of the operating system's file system.
+func WithRestoreFS(fsys vfs.FS) RestoreOption {
+	return func(c *restoreConfig) {
+		c.fs = fsys
+	}
+}
+
+// restorer replays records in LSN order, checking that none are missing.
+// Records may skip LSNs, see Append, so missing data shows as a missing
+// segment rather than as a gap between LSNs.
+type restorer struct {
+	cfg   restoreConfig
+	keys  *keyring
+	apply func(*Log) error
+	last  uint64 // LSN of the last record applied, or the snapshot's
+	seg   int    // id of the last segment replayed or skipped, 0 before any
+
+	legacy bool // the legacy WAL.log has been replayed or skipped
+}
+
+// Restore replays the records in the archive at archiveDir, and with
+// WithRestoreWAL those still in the log, calling apply for each in LSN order.
+// It starts after the snapshot given by WithSnapshotLSN and stops at the
+// target given by WithTargetLSN or WithTargetTime, or at the end. It returns
+// the LSN of the last record applied. If a segment between the snapshot and
+// the target is missing, or the target LSN is never reached, it fails with
+// ErrIncompleteArchive. Archived segments must be intact; damage is reported
+// as ErrCorruptWAL.
+func Restore(archiveDir string, apply func(*Log) error, opts ...RestoreOption) (uint64, error) {
+	cfg := restoreConfig{fs: vfs.OS()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	rs := &restorer{cfg: cfg, keys: newKeyring(cfg.keys), apply: apply, last: cfg.snapshotLSN}
+
+	segments, err := ReadArchiveManifestFS(cfg.fs, archiveDir)
+	if err != nil {
+		return rs.last, err
+	}
+	for _, s := range segments {
+		if rs.covered(s) {
+			rs.seg, rs.legacy = s.ID, rs.legacy || s.ID == 0
+			continue
+		}
+
+		done, err := rs.replayArchived(filepath.Join(archiveDir, s.File), s.ID, s.Codec, s.End)
+		if err != nil || done {
+			return rs.last, err
+		}
+	}
+
+	if cfg.walDir != "" {
+		files, err := listWALFiles(cfg.fs, cfg.walDir)
+		if err != nil {
+			return rs.last, err
+		}
+		for _, path := range files {
+			// Zero for the legacy WAL.log, which comes before any segment.
+			id, _ := segmentmanager.ParseSegmentName(filepath.Base(path))
+			if id != 0 && id <= rs.seg || id == 0 && (rs.legacy || rs.seg != 0) {
+				// Archived, but not yet removed.
+				continue
+			}
+			info, err := cfg.fs.Stat(path)
+			if errors.Is(err, os.ErrNotExist) {
+				// Checkpointed, and archived, since it was listed.
+				continue
+			}
+			if err != nil {
+				return rs.last, err
+			}
+			done, err := rs.replay(cfg.fs, path, id, TolerateCorruptedTail, info.ModTime())
+			if err != nil || done {
+				return rs.last, err
+			}
+		}
+	}
+
+	if cfg.targetLSN != 0 && rs.last < cfg.targetLSN {
+		return rs.last, fmt.Errorf("%w: restored up to %d of %d", ErrIncompleteArchive, rs.last, cfg.targetLSN)
+	}
+	return rs.last, nil
+}
+
+// covered reports whether the snapshot holds every record of the archived
+// segment s. The records of the legacy WAL.log have no LSNs; they predate LSN
+// 1, so any snapshot holds them.
+func (rs *restorer) covered(s ArchivedSegment) bool {
+	if s.ID == 0 {
+		return rs.cfg.snapshotLSN != 0
+	}
+	return s.LastLSN <= rs.last
+}
+
+// past reports whether l, from a file last written at end, was written after
+// the target time.
+func (rs *restorer) past(l *Log, end time.Time) bool {
+	if rs.cfg.targetTime.IsZero() {
+		return false
+	}
+	if l.ts != 0 {
+		return l.Timestamp().After(rs.cfg.targetTime)
+	}
+	return end.After(rs.cfg.targetTime)
+}
+
+// replayArchived replays an archived segment, decompressing it into memory
+// first if needed.
+func (rs *restorer) replayArchived(path string, id int, codec byte, end time.Time) (bool, error) {
+	if codec == 0 {
+		return rs.replay(rs.cfg.fs, path, id, AbsoluteConsistency, end)
+	}
+
+	c, err := lookupCodec(codec)
+	if err != nil {
+		return false, err
+	}
+	data, err := vfs.ReadFile(rs.cfg.fs, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read archived segment: %w", err)
+	}
+	if data, err = c.Decompress(nil, data); err != nil {
+		return false, fmt.Errorf("%s: %w: %w", filepath.Base(path), ErrCorruptWAL, err)
+	}
+
+	mem := vfs.NewMem()
+	name := strings.TrimSuffix(filepath.Base(path), archiveSuffix)
+	f, err := vfs.Create(mem, name)
+	if err == nil {
+		_, err = f.Write(data)
+		err = errors.Join(err, f.Close())
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to restore archived segment: %w", err)
+	}
+
+	return rs.replay(mem, name, id, AbsoluteConsistency, end)
+}
+
+// enter moves on to segment id, checking that it is the one after the last
+// segment replayed or skipped. It reports whether id is the first segment of
+// the restore; id 0 is the legacy WAL.log.
+func (rs *restorer) enter(id int) (bool, error) {
+	if id == 0 {
+		rs.legacy = true
+		return rs.seg == 0, nil
+	}
+	if rs.seg != 0 && id != rs.seg+1 {
+		return false, fmt.Errorf("%w: segments %d to %d are missing after LSN %d", ErrIncompleteArchive, rs.seg+1, id-1, rs.last)
+	}
+
+	first := rs.seg == 0
+	rs.seg = id
+	return first, nil
+}
+
+// replay applies the records of segment id, the log file at path in fsys last
+// written at end, that follow the last one applied, and reports whether the
+// target has been reached.
+func (rs *restorer) replay(fsys vfs.FS, path string, id int, mode RecoveryMode, end time.Time) (bool, error) {
+	first, err := rs.enter(id)
+	if err != nil {
+		return false, err
+	}
+
+	r, err := newFileReader(fsys, path, rs.keys, mode)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		lsn := l.LSN()
+		// Unless the log starts here, the segments before this one, which are
+		// gone, must hold nothing past the snapshot.
+		if first && id > 1 && lsn > rs.last+1 {
+			return false, fmt.Errorf("%w: LSNs %d to %d are missing", ErrIncompleteArchive, rs.last+1, lsn-1)
+		}
+		first = false
+
+		if lsn == 0 {
+			// A legacy record, which predates LSN 1.
+			if rs.cfg.snapshotLSN != 0 {
+				continue
+			}
+		} else if lsn <= rs.last {
+			continue
+		}
+		if rs.cfg.targetLSN != 0 && lsn > rs.cfg.targetLSN || rs.past(l, end) {
+			return true, nil
+		}
+
+		if err := rs.apply(l); err != nil {
+			return false, err
+		}
+		rs.last = max(rs.last, lsn)
+		if lsn != 0 && lsn == rs.cfg.targetLSN {
+			return true, nil
+		}
+	}
+}
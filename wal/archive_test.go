@@ -0,0 +1,332 @@
+package wal
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// checkpointDir reopens the WAL in dir with opts and checkpoints up to lsn.
+func checkpointDir(t *testing.T, dir string, lsn uint64, opts ...Option) {
+	t.Helper()
+	w, err := NewWALWriter(1, dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Checkpoint(lsn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// restoreLSNs runs Restore and returns the LSNs applied.
+func restoreLSNs(archive string, opts ...RestoreOption) ([]uint64, uint64, error) {
+	var lsns []uint64
+	last, err := Restore(archive, func(l *Log) error {
+		lsns = append(lsns, l.LSN())
+		return nil
+	}, opts...)
+	return lsns, last, err
+}
+
+func TestArchiveManifest(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	opts := []Option{WithMaxSegmentSize(1 << 9), WithArchive(archive, NewFlateCodec(flate.BestSpeed))}
+	writeKeys(t, dir, 100, opts...)
+	checkpointDir(t, dir, 60, opts...)
+
+	segments, err := ReadArchiveManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected several archived segments, got %d", len(segments))
+	}
+
+	var next uint64 = 1
+	for i, s := range segments {
+		if s.ID != i+1 || s.FirstLSN != next || s.LastLSN < s.FirstLSN || s.LastLSN > 60 {
+			t.Fatalf("segment %d: unexpected %+v", i, s)
+		}
+		if s.Codec != CodecFlate || s.Start.IsZero() || s.End.Before(s.Start) {
+			t.Fatalf("segment %d: unexpected %+v", i, s)
+		}
+		next = s.LastLSN + 1
+
+		info, err := os.Stat(filepath.Join(archive, s.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() >= s.Size {
+			t.Fatalf("segment %d not compressed: %d >= %d", i, info.Size(), s.Size)
+		}
+		if _, err := os.Stat(segmentPath(dir, s.ID)); !os.IsNotExist(err) {
+			t.Fatalf("archived segment %d still in the WAL: %v", s.ID, err)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	opts := []Option{WithMaxSegmentSize(1 << 9), WithArchive(archive, NewFlateCodec(flate.BestSpeed))}
+	writeKeys(t, dir, 100, opts...)
+	checkpointDir(t, dir, 60, opts...)
+
+	segments, err := ReadArchiveManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := segments[len(segments)-1].LastLSN
+
+	tests := []struct {
+		name       string
+		opts       []RestoreOption
+		first      uint64
+		last       uint64
+		incomplete bool
+	}{
+		{"archive", nil, 1, archived, false},
+		{"snapshot to target", []RestoreOption{WithSnapshotLSN(10), WithTargetLSN(50)}, 11, 50, false},
+		{"with WAL", []RestoreOption{WithSnapshotLSN(5), WithRestoreWAL(dir)}, 6, 100, false},
+		{"target in WAL", []RestoreOption{WithTargetLSN(80), WithRestoreWAL(dir)}, 1, 80, false},
+		{"target beyond archive", []RestoreOption{WithTargetLSN(80)}, 1, archived, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lsns, last, err := restoreLSNs(archive, tt.opts...)
+			if tt.incomplete != errors.Is(err, ErrIncompleteArchive) || !tt.incomplete && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if last != tt.last || len(lsns) != int(tt.last-tt.first+1) || lsns[0] != tt.first {
+				t.Fatalf("restored %d records from %d up to %d, want %d to %d", len(lsns), lsns[0], last, tt.first, tt.last)
+			}
+			for i, lsn := range lsns {
+				if lsn != tt.first+uint64(i) {
+					t.Fatalf("record %d has LSN %d", i, lsn)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreDetectsMissingSegment(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	opts := []Option{WithMaxSegmentSize(1 << 9), WithArchive(archive, nil)}
+	writeKeys(t, dir, 100, opts...)
+	checkpointDir(t, dir, 60, opts...)
+
+	segments, err := ReadArchiveManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArchiveManifest(vfs.OS(), archive, append(segments[:1:1], segments[2:]...)); err != nil {
+		t.Fatal(err)
+	}
+
+	lsns, last, err := restoreLSNs(archive)
+	if !errors.Is(err, ErrIncompleteArchive) || last != segments[0].LastLSN || len(lsns) != int(last) {
+		t.Fatalf("expected ErrIncompleteArchive after LSN %d, got %v after %d", segments[0].LastLSN, err, last)
+	}
+}
+
+func TestRestoreAcrossLSNGap(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(1<<10), WithArchive(archive, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// A follower appending the primary's records skips the LSNs it never saw.
+	var want []uint64
+	for i := range 30 {
+		lsn := uint64(i + 1 + i/8*10)
+		l := NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), make([]byte, 100))
+		l.setLSN(lsn)
+		if err := w.Append(l); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, lsn)
+	}
+	last := want[len(want)-1]
+	if err := w.Checkpoint(last); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := ReadArchiveManifest(archive); len(segments) < 2 {
+		t.Fatalf("expected the gaps to span archived segments, got %v", segments)
+	}
+
+	lsns, got, err := restoreLSNs(archive, WithRestoreWAL(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != last || fmt.Sprint(lsns) != fmt.Sprint(want) {
+		t.Fatalf("restored %v up to %d", lsns, got)
+	}
+}
+
+func TestRestoreLegacyFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint bool // archive the legacy file rather than leave it in dir
+		opts       []RestoreOption
+		want       string
+	}{
+		{"archived", true, nil, "[old-0 old-1 key-0 key-1 key-2]"},
+		{"in WAL", false, nil, "[old-0 old-1 key-0 key-1 key-2]"},
+		{"snapshot", true, []RestoreOption{WithSnapshotLSN(1)}, "[key-1 key-2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, archive := t.TempDir(), t.TempDir()
+			legacy, err := os.Create(filepath.Join(dir, WalFilePath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range []string{"old-0", "old-1"} {
+				if err := NewLog(types.OperationPut, []byte(k), nil).Encode(legacy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_ = legacy.Close()
+
+			opts := []Option{WithArchive(archive, NewFlateCodec(flate.BestSpeed))}
+			writeKeys(t, dir, 3, opts...)
+			if tt.checkpoint {
+				checkpointDir(t, dir, 1, opts...)
+				if _, err := os.Stat(filepath.Join(dir, WalFilePath)); !os.IsNotExist(err) {
+					t.Fatalf("legacy WAL left in place: %v", err)
+				}
+				segments, err := ReadArchiveManifest(archive)
+				if err != nil || len(segments) != 1 || segments[0].ID != 0 {
+					t.Fatalf("expected the legacy WAL in the archive, got %v %v", segments, err)
+				}
+			}
+
+			var keys []string
+			_, err = Restore(archive, func(l *Log) error {
+				keys = append(keys, string(l.Key()))
+				return nil
+			}, append(tt.opts, WithRestoreWAL(dir))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(keys) != tt.want {
+				t.Fatalf("restored %v, want %s", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreToTime(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+
+	// Without timestamps the restore goes by when segments were written.
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(1<<10), WithArchive(archive, nil), WithClock(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := range 40 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), make([]byte, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pretend each sealed segment was finished an hour after the one before.
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for id := 1; id <= 3; id++ {
+		at := base.Add(time.Duration(id) * time.Hour)
+		if err := os.Chtimes(segmentPath(dir, id), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Checkpoint(40); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ReadArchiveManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !segments[1].End.Equal(base.Add(2*time.Hour)) || !segments[1].Start.Equal(base.Add(time.Hour)) {
+		t.Fatalf("unexpected time range %v to %v", segments[1].Start, segments[1].End)
+	}
+
+	_, last, err := restoreLSNs(archive, WithTargetTime(base.Add(150*time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != segments[1].LastLSN {
+		t.Fatalf("restored up to %d, want the end of the second segment at %d", last, segments[1].LastLSN)
+	}
+
+	// An uncompressed archive is a readable log in its own right.
+	r, err := NewWALReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if l, err := r.Read(); err != nil || l.LSN() != 1 {
+		t.Fatalf("reading the archive: %v", err)
+	}
+}
+
+func TestRestoreToRecordTime(t *testing.T) {
+	dir, archive := t.TempDir(), t.TempDir()
+
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(1<<10), WithArchive(archive, nil), WithClock(&stepClock{next: base, step: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := range 40 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), make([]byte, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Checkpoint(40); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ReadArchiveManifest(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range segments {
+		start := base.Add(time.Duration(s.FirstLSN-1) * time.Minute)
+		end := base.Add(time.Duration(s.LastLSN-1) * time.Minute)
+		if !s.Start.Equal(start) || !s.End.Equal(end) {
+			t.Fatalf("segment %d: time range %v to %v, want %v to %v", s.ID, s.Start, s.End, start, end)
+		}
+	}
+
+	// The target falls inside a segment; LSN n was stamped n-1 minutes in.
+	_, last, err := restoreLSNs(archive, WithTargetTime(base.Add(9*time.Minute+30*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 10 {
+		t.Fatalf("restored up to %d, want 10", last)
+	}
+}
+
+func TestArchiveMustNotBeWALDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewWALWriter(1, dir, WithArchive(dir+"/", nil)); err == nil {
+		t.Fatal("expected the WAL directory to be refused as its own archive")
+	}
+}
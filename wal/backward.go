@@ -0,0 +1,202 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+)
+
+// Records only carry their length up front, so a file cannot be decoded from
+// the end. Backward instead splits each file into chunks at the entries of its
+// offset index, reads a chunk forward and hands its records out in reverse,
+// starting with the last chunk. A file without a usable index is first read
+// forward once to find chunk starts about backwardChunkSize apart.
+
+// backwardChunkSize is the span of the chunks a file without an offset index
+// is split into, which bounds the records Backward holds at a time.
+const backwardChunkSize = 64 << 10
+
+// backwardItem is a record, or damage, of the chunk being read backwards.
+type backwardItem struct {
+	log Log
+	err error
+}
+
+// Backward yields the records of the log newest first, down to the
+// checkpoint, for views such as the last N changes. Each file is read in
+// chunks between the entries of its offset index, see WithOffsetIndex, so only
+// one chunk's records are held at a time. A file without an index takes an
+// extra forward pass to split it into chunks of backwardChunkSize, so it is
+// read twice. Damage the recovery mode would drop is skipped and anything else
+// is yielded as an error in its place, which the caller may step over by
+// carrying on. PointInTime cannot tell, going backwards, where its consistent
+// prefix ends and reports damage like AbsoluteConsistency. Backward reads
+// through a cursor of its own, see Cursor, and leaves w where it is.
+func (w *WALReader) Backward() iter.Seq2[Log, error] {
+	return func(yield func(Log, error) bool) {
+		c, err := w.Cursor()
+		if err != nil {
+			yield(Log{}, err)
+			return
+		}
+		defer func() {
+			_ = c.Close()
+		}()
+		// Records of a chunk are held until it has been read.
+		c.cfg.reuseBuffers = false
+
+		for idx := len(c.files) - 1; idx >= 0; idx-- {
+			if err := c.closeFile(); err != nil {
+				yield(Log{}, err)
+				return
+			}
+			if err := c.open(idx); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Checkpointed away since the file list was read.
+					continue
+				}
+				yield(Log{}, err)
+				return
+			}
+			if !c.backwardFile(yield) {
+				return
+			}
+		}
+	}
+}
+
+// backwardFile yields the records of the current file newest first. It returns
+// false if the caller stopped or reading failed.
+func (w *WALReader) backwardFile(yield func(Log, error) bool) bool {
+	starts, err := w.chunkStarts()
+	if err != nil {
+		yield(Log{}, err)
+		return false
+	}
+
+	var items []backwardItem
+	end := w.size
+	for k := len(starts) - 1; k >= 0; k-- {
+		if items, err = w.readChunk(items[:0], starts[k], end); err != nil {
+			yield(Log{}, err)
+			return false
+		}
+		for i := len(items) - 1; i >= 0; i-- {
+			if !yield(items[i].log, items[i].err) {
+				return false
+			}
+		}
+		end = starts[k]
+	}
+
+	return true
+}
+
+// chunkStarts returns the offsets of the current file's first record and of
+// every record its offset index points at correctly, in ascending order. If
+// the index has no such entries the file is scanned for them instead.
+func (w *WALReader) chunkStarts() ([]int64, error) {
+	starts := []int64{w.hdr.size()}
+
+	entries, err := readIndex(w.cfg.fs, indexPath(w.files[w.idx]))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.offset <= starts[len(starts)-1] {
+			continue
+		}
+		ok, err := w.checkEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			starts = append(starts, e.offset)
+		}
+	}
+	if len(starts) == 1 {
+		return w.scanChunkStarts()
+	}
+
+	return starts, nil
+}
+
+// scanChunkStarts reads the current file forward and returns the offsets of
+// its first record and of the first record at least backwardChunkSize past
+// each one before. Only the offsets are kept; damage is left to readChunk.
+func (w *WALReader) scanChunkStarts() ([]int64, error) {
+	starts := []int64{w.hdr.size()}
+	if err := w.rewind(starts[0]); err != nil {
+		return nil, err
+	}
+
+	for {
+		_, err := w.decode()
+		if err == io.EOF {
+			return starts, nil
+		}
+		if _, ok := err.(*corruptionError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if w.recStart-starts[len(starts)-1] >= backwardChunkSize {
+			starts = append(starts, w.recStart)
+		}
+	}
+}
+
+// readChunk appends the records of the current file that start in
+// [start, end) to items, along with the damage among them.
+func (w *WALReader) readChunk(items []backwardItem, start, end int64) ([]backwardItem, error) {
+	if err := w.rewind(start); err != nil {
+		return items, err
+	}
+
+	for {
+		log, err := w.decode()
+		if err == io.EOF {
+			return items, nil
+		}
+
+		if ce, ok := err.(*corruptionError); ok {
+			if ce.offset >= end {
+				return items, nil
+			}
+			if err := w.backwardDamage(ce); err != nil {
+				items = append(items, backwardItem{err: err})
+			}
+			continue
+		}
+		if err != nil {
+			return items, err
+		}
+
+		if w.recStart >= end {
+			return items, nil
+		}
+		if w.checkpoint != 0 && log.LSN() <= w.checkpoint {
+			continue
+		}
+		items = append(items, backwardItem{log: *log})
+	}
+}
+
+// backwardDamage returns the error Backward reports for ce, or nil if the
+// recovery mode drops it without one.
+func (w *WALReader) backwardDamage(ce *corruptionError) error {
+	switch w.cfg.recoveryMode {
+	case SkipCorrupted:
+		return nil
+	case TolerateCorruptedTail:
+		if ce.tail {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", filepath.Base(w.files[w.idx]), ce)
+}
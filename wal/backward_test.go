@@ -0,0 +1,201 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// collectBackward returns the LSNs Backward yields and the errors in between,
+// as zeros in the LSN list, stopping after limit records if limit is positive.
+func collectBackward(t *testing.T, r *WALReader, limit int) ([]uint64, []error) {
+	t.Helper()
+	var lsns []uint64
+	var errs []error
+	for l, err := range r.Backward() {
+		if err != nil {
+			errs = append(errs, err)
+			lsns = append(lsns, 0)
+			continue
+		}
+		lsns = append(lsns, l.LSN())
+		if len(lsns) == limit {
+			break
+		}
+	}
+	return lsns, errs
+}
+
+func TestBackward(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no index", nil},
+		{"index", []Option{WithOffsetIndex(512)}},
+		{"framed index", []Option{WithOffsetIndex(512), WithBlockFraming()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKeys(t, dir, 200, append([]Option{WithMaxSegmentSize(1 << 10)}, tt.opts...)...)
+
+			r, err := NewWALReader(dir, WithBufferReuse())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = r.Close()
+			}()
+
+			lsns, errs := collectBackward(t, r, 0)
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+			if len(lsns) != 200 {
+				t.Fatalf("expected 200 records, got %d", len(lsns))
+			}
+			for i, lsn := range lsns {
+				if lsn != uint64(200-i) {
+					t.Fatalf("record %d has LSN %d", i, lsn)
+				}
+			}
+
+			lsns, _ = collectBackward(t, r, 3)
+			if len(lsns) != 3 || lsns[0] != 200 || lsns[2] != 198 {
+				t.Fatalf("last 3 records: %v", lsns)
+			}
+
+			// The reader itself has not moved.
+			l, err := r.Read()
+			if err != nil || l.LSN() != 1 {
+				t.Fatalf("expected LSN 1 from Read, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBackwardStopsAtCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 50, WithMaxSegmentSize(1<<10), WithOffsetIndex(256))
+	if err := writeCheckpoint(vfs.OS(), dir, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	lsns, errs := collectBackward(t, r, 0)
+	if len(errs) != 0 || len(lsns) != 30 || lsns[29] != 21 {
+		t.Fatalf("expected LSNs 50 down to 21, got %v %v", lsns, errs)
+	}
+}
+
+func TestBackwardReportsDamage(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 10)
+
+	// Break the checksum of the fourth record.
+	data := readSegment(t, dir, 1)
+	off := int64(HeaderSize)
+	for range 3 {
+		off += 4 + int64(binary.LittleEndian.Uint32(data[off+4:]))
+	}
+	data[off] ^= 0xff
+	if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode RecoveryMode
+		want []uint64
+	}{
+		{TolerateCorruptedTail, []uint64{10, 9, 8, 7, 6, 5, 0, 3, 2, 1}},
+		{SkipCorrupted, []uint64{10, 9, 8, 7, 6, 5, 3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			r, err := NewWALReader(dir, WithRecoveryMode(tt.mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = r.Close()
+			}()
+
+			lsns, errs := collectBackward(t, r, 0)
+			for _, err := range errs {
+				if !errors.Is(err, ErrCorruptWAL) {
+					t.Fatalf("unexpected error %v", err)
+				}
+			}
+			if len(lsns) != len(tt.want) {
+				t.Fatalf("got %v, want %v", lsns, tt.want)
+			}
+			for i := range lsns {
+				if lsns[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", lsns, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackwardChunksFileWithoutIndex(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("framed=%v", framed), func(t *testing.T) {
+			dir := t.TempDir()
+			values := make([][]byte, 100)
+			for i := range values {
+				values[i] = make([]byte, 4<<10)
+			}
+			var opts []Option
+			if framed {
+				opts = append(opts, WithBlockFraming())
+			}
+			writeLogs(t, dir, puts(values...), opts...)
+
+			r, err := NewWALReader(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = r.Close()
+			}()
+
+			starts, err := r.chunkStarts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(starts) < 5 {
+				t.Fatalf("expected the file split into chunks, got starts %v", starts)
+			}
+			for i := 1; i < len(starts); i++ {
+				if gap := starts[i] - starts[i-1]; gap > backwardChunkSize+5<<10 {
+					t.Fatalf("chunk %d spans %d bytes", i-1, gap)
+				}
+			}
+
+			lsns, errs := collectBackward(t, r, 0)
+			if len(errs) != 0 || len(lsns) != 100 || lsns[0] != 100 || lsns[99] != 1 {
+				t.Fatalf("got %d records %v", len(lsns), errs)
+			}
+			for i, lsn := range lsns {
+				if lsn != uint64(100-i) {
+					t.Fatalf("record %d has LSN %d", i, lsn)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package wal
+
+import (
+	"encoding/binary"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+// Batch groups Put and Delete operations into a single WAL record. The whole
+// batch shares one LSN and one CRC, so after a crash it is replayed either
+// completely or not at all.
+//
+// Batch body, following the TYPE byte and LSN of the record:
+// | COUNT (4) | TYPE (1) | KEY_LEN (4) | KEY | VAL_LEN (4) | VALUE | ...
+type Batch struct {
+	ops []*Log
+}
+
+// NewBatch creates an empty batch.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Add appends an operation to the batch. It fails with ErrInvalidOperation,
+// leaving the batch as it was, unless op is a Put or a Delete.
+func (b *Batch) Add(op types.Operation, key, value []byte) error {
+	if err := checkOp(op); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, NewLog(op, key, value))
+	return nil
+}
+
+// Put appends a Put of key to the batch.
+func (b *Batch) Put(key, value []byte) {
+	b.ops = append(b.ops, NewLog(types.OperationPut, key, value))
+}
+
+// Delete appends a Delete of key to the batch.
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, NewLog(types.OperationDelete, key, nil))
+}
+
+// Len returns the number of operations in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Log wraps the batch in a record that can be passed to WALWriter.Write.
+func (b *Batch) Log() *Log {
+	ops := b.ops
+	if ops == nil {
+		ops = []*Log{}
+	}
+	return &Log{batch: ops}
+}
+
+// WriteBatch writes every operation in b as one atomic record and returns its
+// LSN.
+func (w *WALWriter) WriteBatch(b *Batch) (uint64, error) {
+	return w.Write(b.Log())
+}
+
+// IsBatch reports whether the record holds a batch of operations rather than
+// a single one.
+func (l *Log) IsBatch() bool {
+	return l.batch != nil
+}
+
+// Batch returns the operations of a batch record in the order they were
+// added. Once written, each of them carries the batch's LSN. For a batch
+// record Op, Key and Value are empty.
+func (l *Log) Batch() []*Log {
+	return l.batch
+}
+
+func (l *Log) batchBodySize() int {
+	size := 4
+	for _, op := range l.batch {
+		size += 1 + 4 + len(op.key) + 4 + len(op.value)
+	}
+	return size
+}
+
+func (l *Log) appendBatchBody(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(l.batch)))
+
+	for _, op := range l.batch {
+		dst = append(dst, byte(op.op))
+		dst = appendKeyValue(dst, op.key, op.value)
+	}
+
+	return dst
+}
+
+func (l *Log) decodeBatchBody(body []byte) error {
+	if len(body) < 4 {
+		return ErrCorruptWAL
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+
+	// Every operation takes at least 9 bytes, which bounds the allocation
+	// below for a count that passed the CRC but is still nonsense.
+	if uint64(count)*9 > uint64(len(body)) {
+		return ErrCorruptWAL
+	}
+
+	// Reuse the operations of a previous batch decoded into l.
+	ops := l.batch[:0]
+	if ops == nil {
+		ops = make([]*Log, 0, count)
+	}
+
+	for range count {
+		if len(body) < 1 || body[0] > byte(types.OperationDelete) {
+			return ErrCorruptWAL
+		}
+
+		var op *Log
+		if len(ops) < cap(ops) {
+			op = ops[:len(ops)+1][len(ops)]
+		}
+		if op == nil {
+			op = &Log{}
+		}
+		*op = Log{op: types.Operation(body[0]), lsn: l.lsn, ts: l.ts}
+		body = body[1:]
+
+		var ok bool
+		if op.key, body, ok = readLenPrefixed(body); !ok {
+			return ErrCorruptWAL
+		}
+		if op.value, body, ok = readLenPrefixed(body); !ok {
+			return ErrCorruptWAL
+		}
+		ops = append(ops, op)
+	}
+	l.batch = ops
+
+	if len(body) != 0 {
+		return ErrCorruptWAL
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package wal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func TestBatchEncodeDecodeRoundTrip(t *testing.T) {
+	withTempWAL(t, func(f *os.File) {
+		b := NewBatch()
+		b.Put([]byte("a"), []byte("1"))
+		b.Delete([]byte("b"))
+		if err := b.Add(types.OperationPut, []byte{0, 1}, bytes.Repeat([]byte("v"), 300)); err != nil {
+			t.Fatal(err)
+		}
+
+		l := b.Log()
+		l.setLSN(7)
+		if err := l.Encode(f); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Seek(0, io.SeekStart)
+
+		got, err := Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.IsBatch() || got.LSN() != 7 {
+			t.Fatalf("expected batch with LSN 7, got %v", got)
+		}
+
+		ops := got.Batch()
+		if len(ops) != b.Len() {
+			t.Fatalf("expected %d operations, got %d", b.Len(), len(ops))
+		}
+		for i, want := range b.ops {
+			if ops[i].Op() != want.Op() ||
+				!bytes.Equal(ops[i].Key(), want.Key()) ||
+				!bytes.Equal(ops[i].Value(), want.Value()) ||
+				ops[i].LSN() != 7 {
+				t.Fatalf("operation %d mismatch: %v", i, ops[i])
+			}
+		}
+	})
+}
+
+func TestEmptyBatch(t *testing.T) {
+	withTempWAL(t, func(f *os.File) {
+		if err := NewBatch().Log().Encode(f); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Seek(0, io.SeekStart)
+
+		got, err := Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.IsBatch() || len(got.Batch()) != 0 {
+			t.Fatalf("expected empty batch, got %v", got)
+		}
+	})
+}
+
+func TestBatchIsAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBatch()
+	b.Put([]byte("from"), []byte("90"))
+	b.Put([]byte("to"), []byte("110"))
+	lsn, err := w.WriteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 1 {
+		t.Fatalf("expected LSN 1, got %d", lsn)
+	}
+	w.Close()
+
+	segment := readSegment(t, dir, 1)
+
+	// Cutting the batch anywhere must drop both operations together.
+	for cut := HeaderSize + 1; cut < len(segment); cut++ {
+		if err := os.WriteFile(segmentPath(dir, 1), segment[:cut], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if keys := readKeys(t, dir); len(keys) != 0 {
+			t.Fatalf("cut at %d: partial batch replayed: %v", cut, keys)
+		}
+	}
+
+	if err := os.WriteFile(segmentPath(dir, 1), segment, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	l, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.IsBatch() || len(l.Batch()) != 2 || string(l.Batch()[1].Key()) != "to" {
+		t.Fatalf("unexpected record %v", l)
+	}
+}
@@ -0,0 +1,300 @@
+package wal
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+)
+
+// Block framing, enabled by WithBlockFraming, lays the records of a segment out
+// in fixed BlockSize blocks following the file header. Each encoded record is
+// split into one or more fragments that never cross a block boundary:
+// | CRC (4) | LEN (2) | TYPE (1) | DATA |
+// CRC = checksum(LEN | TYPE | DATA), with the file's checksum algorithm. A record that fits the rest of the block
+// is a single FULL fragment; anything larger becomes FIRST, MIDDLE..., LAST.
+// When fewer than fragmentHeaderSize bytes remain in a block they are zeroed
+// and the next fragment starts a new block. Because a fragment is never split,
+// a reader that finds a damaged fragment can drop the rest of its block and
+// pick up again at the next boundary.
+const (
+	BlockSize = 32 << 10 // 32KB
+
+	// MaxFramedEntrySize replaces MaxEntrySize for block framed segments.
+	MaxFramedEntrySize = 1 << 30 // 1GB
+
+	fragmentHeaderSize = 7
+)
+
+const (
+	fragmentZero   = 0 // padding, or space that was never written
+	fragmentFull   = 1
+	fragmentFirst  = 2
+	fragmentMiddle = 3
+	fragmentLast   = 4
+)
+
+// headerFlagBlocks marks a segment as block framed in the file header.
+const headerFlagBlocks = 0x01
+
+// WithBlockFraming writes new segments in BlockSize blocks, see BlockSize.
+// Framed segments accept records up to MaxFramedEntrySize, and a reader that
+// hits a damaged block reports it and carries on at the next block. The
+// segment that is active when the writer opens keeps the framing it was
+// created with.
+func WithBlockFraming() Option {
+	return func(c *config) {
+		c.blockFraming = true
+	}
+}
+
+// framed reports whether the file is laid out in blocks.
+func (h fileHeader) framed() bool {
+	return h.flags&headerFlagBlocks != 0
+}
+
+// appendFragments appends rec to dst as a run of fragments checksummed with
+// sum, starting off bytes into the current block, and returns the extended
+// slice and the offset within the block after the last fragment.
+func appendFragments(dst, rec []byte, off int, sum checksum.Algorithm) ([]byte, int) {
+	first := true
+	for {
+		left := BlockSize - off
+		if left < fragmentHeaderSize {
+			dst = append(dst, make([]byte, left)...)
+			off, left = 0, BlockSize
+		}
+
+		n := min(left-fragmentHeaderSize, len(rec))
+		last := n == len(rec)
+
+		var typ byte
+		switch {
+		case first && last:
+			typ = fragmentFull
+		case first:
+			typ = fragmentFirst
+		case last:
+			typ = fragmentLast
+		default:
+			typ = fragmentMiddle
+		}
+
+		start := len(dst)
+		dst = binary.LittleEndian.AppendUint32(dst, 0)
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(n))
+		dst = append(dst, typ)
+		dst = append(dst, rec[:n]...)
+		binary.LittleEndian.PutUint32(dst[start:], sum.Checksum(dst[start+4:]))
+
+		off += fragmentHeaderSize + n
+		rec = rec[n:]
+		first = false
+
+		if last {
+			return dst, off
+		}
+	}
+}
+
+// framedSize returns how many bytes appendFragments produces for a record of
+// n bytes starting off bytes into a block.
+func framedSize(n, off int) int {
+	size := 0
+	for first := true; first || n > 0; first = false {
+		left := BlockSize - off
+		if left < fragmentHeaderSize {
+			size += left
+			off, left = 0, BlockSize
+		}
+		chunk := min(left-fragmentHeaderSize, n)
+		size += fragmentHeaderSize + chunk
+		off += fragmentHeaderSize + chunk
+		n -= chunk
+	}
+	return size
+}
+
+// blockReader reassembles records from the blocks of a framed file whose
+// first block starts at file offset base.
+type blockReader struct {
+	r     io.Reader
+	base  int64
+	sum   checksum.Algorithm
+	block []byte
+	off   int64 // file offset of block[0]
+	pos   int   // next fragment in block
+	eof   bool  // block is the last one in the file
+
+	start, end int64 // span of the last complete record
+}
+
+func newBlockReader(r io.Reader, base int64, sum checksum.Algorithm) *blockReader {
+	b := &blockReader{}
+	b.reset(r, base, sum)
+	return b
+}
+
+func (b *blockReader) reset(r io.Reader, base int64, sum checksum.Algorithm) {
+	if b.block == nil {
+		b.block = make([]byte, 0, BlockSize)
+	}
+	b.r, b.base, b.sum = r, base, sum
+	b.block = b.block[:0]
+	b.off, b.pos, b.eof = base, 0, false
+	b.start, b.end = base, base
+}
+
+// seek repositions the reader at offset in r, which must lie on a fragment
+// boundary.
+func (b *blockReader) seek(r io.ReadSeeker, offset int64) error {
+	blockStart := b.base + (offset-b.base)/BlockSize*BlockSize
+	if _, err := r.Seek(blockStart, io.SeekStart); err != nil {
+		return err
+	}
+
+	b.r = r
+	b.block = b.block[:0]
+	b.off, b.pos, b.eof = blockStart, 0, false
+	if err := b.readBlock(); err != nil {
+		return err
+	}
+
+	b.pos = int(offset - blockStart)
+	b.start, b.end = offset, offset
+
+	return nil
+}
+
+func (b *blockReader) readBlock() error {
+	b.off += int64(len(b.block))
+	b.block = b.block[:BlockSize]
+	b.pos = 0
+
+	n, err := io.ReadFull(b.r, b.block)
+	b.block = b.block[:n]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		b.eof = true
+		return nil
+	}
+	return err
+}
+
+// corrupt drops the rest of the current block and reports the damaged range
+// starting at from.
+func (b *blockReader) corrupt(from int64) error {
+	b.pos = len(b.block)
+	return &corruptionError{offset: from, length: b.off + int64(b.pos) - from}
+}
+
+// next appends the next complete record to dst. A damaged fragment, or one
+// that does not fit the record being assembled, is reported as ErrCorruptWAL
+// and skipped, so calling next again resumes with the following record. A
+// record cut short by the end of the file is torn and reported as io.EOF.
+func (b *blockReader) next(dst []byte) ([]byte, error) {
+	start := len(dst)
+	inRecord := false
+	var recOff int64
+
+	for {
+		if len(b.block)-b.pos < fragmentHeaderSize {
+			if b.eof {
+				return dst[:start], io.EOF
+			}
+			if err := b.readBlock(); err != nil {
+				return dst[:start], err
+			}
+			continue
+		}
+
+		h := b.block[b.pos:]
+		fragOff := b.off + int64(b.pos)
+		crc := binary.LittleEndian.Uint32(h)
+		n := int(binary.LittleEndian.Uint16(h[4:]))
+		typ := h[6]
+
+		if typ == fragmentZero && n == 0 && crc == 0 {
+			// Padding at the end of a block.
+			b.pos = len(b.block)
+			continue
+		}
+
+		from := fragOff
+		if inRecord {
+			from = recOff
+		}
+
+		if fragmentHeaderSize+n > len(h) {
+			if b.eof {
+				return dst[:start], io.EOF
+			}
+			return dst[:start], b.corrupt(from)
+		}
+		if b.sum.Checksum(h[4:fragmentHeaderSize+n]) != crc {
+			return dst[:start], b.corrupt(from)
+		}
+		data := h[fragmentHeaderSize : fragmentHeaderSize+n]
+
+		switch typ {
+		case fragmentFull, fragmentFirst:
+			if inRecord {
+				// The record in progress lost its tail. Leave this fragment
+				// for the next call.
+				return dst[:start], &corruptionError{offset: recOff, length: fragOff - recOff}
+			}
+			inRecord, recOff = true, fragOff
+		case fragmentMiddle, fragmentLast:
+			if !inRecord {
+				// The rest of a record whose start was lost.
+				b.pos += fragmentHeaderSize + n
+				return dst[:start], &corruptionError{offset: fragOff, length: int64(fragmentHeaderSize + n)}
+			}
+		default:
+			return dst[:start], b.corrupt(from)
+		}
+
+		if len(dst)-start+n > 4+MaxFramedEntrySize {
+			return dst[:start], b.corrupt(from)
+		}
+
+		dst = append(dst, data...)
+		b.pos += fragmentHeaderSize + n
+
+		if typ == fragmentFull || typ == fragmentLast {
+			b.start, b.end = recOff, b.off+int64(b.pos)
+			return dst, nil
+		}
+	}
+}
+
+// DecodeBytes parses the single complete record held in b, which may be up to
+// MaxFramedEntrySize. The key and value alias b. Like DecodeInto, it expects
+// the default checksum and needs WithCodecKeys for encrypted records.
+func DecodeBytes(b []byte, opts ...CodecOption) (*Log, error) {
+	var l Log
+	if err := decodeRecord(b, &l, checksum.Default, codecKeys(opts)); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// decodeRecord parses a complete encoded record reassembled from fragments,
+// verifying it with sum and opening encrypted bodies with keys. The key and
+// value alias rec.
+func decodeRecord(rec []byte, l *Log, sum checksum.Algorithm, keys *keyring) error {
+	if len(rec) < 9 {
+		return ErrCorruptWAL
+	}
+
+	storedCRC := binary.LittleEndian.Uint32(rec[0:4])
+	totalLen := binary.LittleEndian.Uint32(rec[4:8])
+	if uint64(totalLen) != uint64(len(rec)-4) {
+		return ErrCorruptWAL
+	}
+	if sum.Checksum(rec[4:]) != storedCRC {
+		return ErrCorruptWAL
+	}
+
+	l.crc = storedCRC
+	return l.decodePayload(rec[8:], keys)
+}
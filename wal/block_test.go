@@ -0,0 +1,273 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func fragmentTypes(t *testing.T, framed []byte) []byte {
+	t.Helper()
+	var kinds []byte
+	for off := 0; off < len(framed); {
+		if BlockSize-off%BlockSize < fragmentHeaderSize {
+			off += BlockSize - off%BlockSize
+			continue
+		}
+		n := int(binary.LittleEndian.Uint16(framed[off+4:]))
+		kinds = append(kinds, framed[off+6])
+		off += fragmentHeaderSize + n
+	}
+	return kinds
+}
+
+func TestAppendFragments(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		off   int
+		types []byte
+	}{
+		{"fits", 100, 0, []byte{fragmentFull}},
+		{"spills into next block", 100, BlockSize - 50, []byte{fragmentFirst, fragmentLast}},
+		{"spans blocks", 3 * BlockSize, 0, []byte{fragmentFirst, fragmentMiddle, fragmentMiddle, fragmentLast}},
+		{"pads short block end", 100, BlockSize - fragmentHeaderSize + 1, []byte{fragmentFull}},
+		{"empty first fragment", 100, BlockSize - fragmentHeaderSize, []byte{fragmentFirst, fragmentLast}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := bytes.Repeat([]byte{0xAB}, tt.size)
+
+			// Put a filler record in front so the fragments land at their
+			// real offset in the block.
+			var prefix []byte
+			if tt.off > 0 {
+				prefix, _ = appendFragments(nil, make([]byte, tt.off-fragmentHeaderSize), 0, checksum.Default)
+			}
+			framed, off := appendFragments(prefix, rec, tt.off, checksum.Default)
+			if got := len(framed) - len(prefix); got != framedSize(tt.size, tt.off) {
+				t.Fatalf("framedSize = %d, wrote %d", framedSize(tt.size, tt.off), got)
+			}
+			if len(framed)%BlockSize != off%BlockSize {
+				t.Fatalf("returned offset %d does not match output length %d", off, len(framed))
+			}
+
+			start := tt.off
+			if BlockSize-start < fragmentHeaderSize {
+				start = BlockSize
+			}
+			if got := fragmentTypes(t, framed[start:]); !bytes.Equal(got, tt.types) {
+				t.Fatalf("fragment types = %v, want %v", got, tt.types)
+			}
+
+			br := newBlockReader(bytes.NewReader(framed), 0, checksum.Default)
+			if tt.off > 0 {
+				if _, err := br.next(nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := br.next(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, rec) {
+				t.Fatal("reassembled record does not match")
+			}
+		})
+	}
+}
+
+func TestBlockFramingRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	values := [][]byte{
+		[]byte("small"),
+		bytes.Repeat([]byte("m"), BlockSize-100),
+		bytes.Repeat([]byte("l"), 3*BlockSize+17),
+		[]byte("after"),
+	}
+	writeLogs(t, dir, puts(values...), WithBlockFraming())
+
+	data := readSegment(t, dir, 1)
+	if data[11]&headerFlagBlocks == 0 {
+		t.Fatal("segment header does not declare block framing")
+	}
+
+	for _, opts := range [][]ReaderOption{nil, {WithBufferReuse()}} {
+		reader, err := NewWALReader(dir, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := 0
+		for l, err := range reader.Iter() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.LSN() != uint64(i+1) || !bytes.Equal(l.Value(), values[i]) {
+				t.Fatalf("record %d mismatch: lsn %d, %d bytes", i, l.LSN(), len(l.Value()))
+			}
+			i++
+		}
+		if i != len(values) {
+			t.Fatalf("expected %d records, got %d", len(values), i)
+		}
+		_ = reader.Close()
+	}
+}
+
+func TestBlockFramingLargeEntry(t *testing.T) {
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("x"), MaxEntrySize+1)
+
+	w, err := NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("big"), big)); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatalf("expected ErrEntryTooLarge without framing, got %v", err)
+	}
+	w.Close()
+
+	writeLogs(t, dir, puts(big), WithBlockFraming())
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	l, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.Value(), big) {
+		t.Fatal("large value mismatch")
+	}
+}
+
+func TestBlockFramingResyncsAfterCorruption(t *testing.T) {
+	dir := t.TempDir()
+
+	// Exactly two records per block: 38 bytes of record and 7 of fragment
+	// header around each value.
+	value := bytes.Repeat([]byte("v"), BlockSize/2-45)
+	values := make([][]byte, 8)
+	for i := range values {
+		values[i] = value
+	}
+	writeLogs(t, dir, puts(values...), WithBlockFraming())
+
+	// Damage the length field of the first fragment in the second block.
+	path := segmentPath(dir, 1)
+	data := readSegment(t, dir, 1)
+	data[HeaderSize+BlockSize+4] ^= 0xFF
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	var errs int
+	for l, err := range reader.Iter() {
+		if err != nil {
+			if !errors.Is(err, ErrCorruptWAL) {
+				t.Fatal(err)
+			}
+			errs++
+			continue
+		}
+		keys = append(keys, string(l.Key()))
+	}
+
+	want := []string{"key-0", "key-1", "key-4", "key-5", "key-6", "key-7"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+	if errs != 1 {
+		t.Fatalf("expected 1 corruption error, got %d", errs)
+	}
+}
+
+func TestBlockFramingReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	value := bytes.Repeat([]byte("v"), BlockSize/3)
+	writeLogs(t, dir, puts(value, value), WithBlockFraming())
+
+	// A torn fragment at the end is cut off when the writer reopens, and the
+	// next record continues from the right offset within the block.
+	torn, _ := appendFragments(nil, bytes.Repeat([]byte("t"), 100), 0, checksum.Default)
+	appendToSegment(t, segmentPath(dir, 1), torn[:50])
+
+	w, err := NewWALWriter(1, dir, WithBlockFraming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Stats().TruncatedTailBytes; got != 50 {
+		t.Fatalf("expected 50 truncated bytes, got %d", got)
+	}
+	for i := range 3 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "more-%d", i), value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	want := []string{"key-0", "key-1", "more-0", "more-1", "more-2"}
+	if got := readKeys(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+}
+
+func TestBlockFramingKeepsActiveSegmentFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("plain"), []byte("v"))); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, err = NewWALWriter(1, dir, WithMaxSegmentSize(1024), WithBlockFraming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"still-plain", "framed"} {
+		if _, err := w.Write(NewLog(types.OperationPut, []byte(key), bytes.Repeat([]byte("v"), 800))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	if readSegment(t, dir, 1)[11]&headerFlagBlocks != 0 {
+		t.Fatal("existing segment switched framing")
+	}
+	if readSegment(t, dir, 2)[11]&headerFlagBlocks == 0 {
+		t.Fatal("new segment is not framed")
+	}
+
+	want := []string{"plain", "still-plain", "framed"}
+	if got := readKeys(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// CheckpointFilePath holds the LSN up to which the log has been persisted
+// elsewhere:
+// | LSN (8) | CRC (4) |
+const CheckpointFilePath = "CHECKPOINT"
+
+var ErrCheckpointAhead = fmt.Errorf("checkpoint is ahead of the log")
+
+// readCheckpoint returns the checkpointed LSN in dir, or 0 if there is none.
+func readCheckpoint(fsys vfs.FS, dir string) (uint64, error) {
+	data, err := vfs.ReadFile(fsys, filepath.Join(dir, CheckpointFilePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	if len(data) != 12 || crc32.ChecksumIEEE(data[:8]) != binary.LittleEndian.Uint32(data[8:]) {
+		return 0, fmt.Errorf("checkpoint: %w", ErrCorruptWAL)
+	}
+
+	return binary.LittleEndian.Uint64(data[:8]), nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint in dir with lsn.
+func writeCheckpoint(fsys vfs.FS, dir string, lsn uint64) error {
+	var buf [12]byte
+	binary.LittleEndian.PutUint64(buf[:8], lsn)
+	binary.LittleEndian.PutUint32(buf[8:], crc32.ChecksumIEEE(buf[:8]))
+
+	return writeFileAtomic(fsys, dir, CheckpointFilePath, buf[:])
+}
+
+// writeFileAtomic durably replaces the file name in dir with data.
+func writeFileAtomic(fsys vfs.FS, dir, name string, data []byte) error {
+	tmp := filepath.Join(dir, name+".tmp")
+	f, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", name, err)
+	}
+
+	if err := fsys.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("failed to install %s: %w", name, err)
+	}
+
+	if err := fsys.SyncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+
+	return nil
+}
+
+// Checkpoint records that every record up to and including lsn is durable
+// elsewhere, for example in a flushed SST, and deletes the sealed segments that
+// hold nothing newer. The active segment is never removed; readers skip its
+// checkpointed records instead. A checkpoint older than the current one is a
+// no-op.
+func (w *WALWriter) Checkpoint(lsn uint64) error {
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+
+	if w.closed.Load() {
+		return ErrWALClosed
+	}
+
+	if lsn > w.LastLSN() {
+		return fmt.Errorf("%w: %d > %d", ErrCheckpointAhead, lsn, w.LastLSN())
+	}
+
+	if lsn <= w.checkpoint {
+		return nil
+	}
+
+	// The checkpoint must be durable before any data it covers is deleted.
+	if err := writeCheckpoint(w.cfg.fs, w.dir, lsn); err != nil {
+		return err
+	}
+	w.checkpoint = lsn
+
+	return w.removeCheckpointed()
+}
+
+// CheckpointLSN returns the most recent checkpoint.
+func (w *WALWriter) CheckpointLSN() uint64 {
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+
+	return w.checkpoint
+}
+
+// removeCheckpointed deletes, or archives, the legacy WAL.log and every sealed
+// segment whose records are all covered by the checkpoint. Records without an
+// LSN predate LSN 1 and are always covered. A damaged segment is kept, along
+// with every segment after it.
+func (w *WALWriter) removeCheckpointed() error {
+	legacy := filepath.Join(w.dir, WalFilePath)
+	if w.cfg.archiveDir != "" {
+		_, err := w.cfg.fs.Stat(legacy)
+		if err == nil {
+			err = w.archive(segmentmanager.Segment{Path: legacy})
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to archive legacy WAL: %w", err)
+		}
+	}
+	if err := w.cfg.fs.Remove(legacy); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove legacy WAL: %w", err)
+	}
+
+	segments, err := w.sm.Segments()
+	if err != nil {
+		return fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+
+	for _, s := range segments[:max(len(segments)-1, 0)] {
+		last, ok := w.sealedLSNs[s.ID]
+		if !ok {
+			scan, err := scanSegment(w.cfg.fs, s.Path, w.enc.keys)
+			if err != nil {
+				return err
+			}
+			// Damage may hide records newer than the checkpoint, so only a
+			// segment read end to end without any is ever removed.
+			if scan.damage != nil || scan.torn {
+				break
+			}
+			last = scan.lastLSN
+			w.sealedLSNs[s.ID] = last
+		}
+
+		// Segments are in LSN order, so the first one that is still needed
+		// means all later ones are too.
+		if last > w.checkpoint {
+			break
+		}
+
+		if w.cfg.archiveDir != "" {
+			if err := w.archive(s); err != nil {
+				return err
+			}
+		}
+		if err := removeIndex(w.cfg.fs, s.Path); err != nil {
+			return err
+		}
+		if err := w.sm.Remove(s.ID); err != nil {
+			return err
+		}
+		delete(w.sealedLSNs, s.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func writeN(t *testing.T, w *WALWriter, n int) {
+	t.Helper()
+	for range n {
+		lsn := w.LastLSN() + 1
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", lsn), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckpointRemovesSealedSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	writeN(t, w, 30)
+
+	before, _ := segmentmanager.ListSegments(dir)
+	if err := w.Checkpoint(20); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := segmentmanager.ListSegments(dir)
+
+	if len(after) >= len(before) {
+		t.Fatalf("expected segments to be removed, had %d now %d", len(before), len(after))
+	}
+	if w.CheckpointLSN() != 20 {
+		t.Fatalf("expected checkpoint 20, got %d", w.CheckpointLSN())
+	}
+
+	// Replay resumes right after the checkpoint and loses nothing newer.
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if reader.CheckpointLSN() != 20 {
+		t.Fatalf("reader sees checkpoint %d", reader.CheckpointLSN())
+	}
+
+	want := uint64(21)
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.LSN() != want {
+			t.Fatalf("expected LSN %d, got %d", want, l.LSN())
+		}
+		want++
+	}
+	if want != 31 {
+		t.Fatalf("replay stopped at %d", want-1)
+	}
+}
+
+func TestCheckpointRejectsFutureLSN(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	writeN(t, w, 3)
+
+	if err := w.Checkpoint(4); !errors.Is(err, ErrCheckpointAhead) {
+		t.Fatalf("expected ErrCheckpointAhead, got %v", err)
+	}
+	if err := w.Checkpoint(3); err != nil {
+		t.Fatal(err)
+	}
+	// Going backwards is a no-op.
+	if err := w.Checkpoint(1); err != nil {
+		t.Fatal(err)
+	}
+	if w.CheckpointLSN() != 3 {
+		t.Fatalf("checkpoint moved backwards to %d", w.CheckpointLSN())
+	}
+}
+
+func TestCheckpointSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeN(t, w, 10)
+	if err := w.Checkpoint(10); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, err = NewWALWriter(1, dir, WithMaxSegmentSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if w.CheckpointLSN() != 10 {
+		t.Fatalf("expected checkpoint 10 after reopen, got %d", w.CheckpointLSN())
+	}
+
+	lsn, err := w.Write(NewLog(types.OperationPut, []byte("next"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 11 {
+		t.Fatalf("expected LSN 11 after reopen, got %d", lsn)
+	}
+
+	if keys := readKeys(t, dir); len(keys) != 1 || keys[0] != "next" {
+		t.Fatalf("expected replay to start after the checkpoint, got %v", keys)
+	}
+}
+
+func TestCheckpointRemovesLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	legacy, err := os.Create(filepath.Join(dir, WalFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = NewLog(types.OperationPut, []byte("old"), nil).Encode(legacy)
+	_ = legacy.Close()
+
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	writeN(t, w, 1)
+	if err := w.Checkpoint(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, WalFilePath)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected legacy WAL to be removed, got %v", err)
+	}
+}
+
+func TestCheckpointRecyclesSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(128), WithSegmentRecycling(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	writeN(t, w, 30)
+	if err := w.Checkpoint(30); err != nil {
+		t.Fatal(err)
+	}
+
+	recycled, err := filepath.Glob(filepath.Join(dir, "recycle-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recycled) == 0 {
+		t.Fatal("expected checkpointed segments to be kept for reuse")
+	}
+
+	// New segments reuse the recycled files, whose old records must not
+	// resurface.
+	writeN(t, w, 30)
+	left, _ := filepath.Glob(filepath.Join(dir, "recycle-*.log"))
+	if len(left) >= len(recycled) {
+		t.Fatalf("recycled segments were not reused: %d before, %d after", len(recycled), len(left))
+	}
+
+	reader, err := NewWALReader(dir, WithRecoveryMode(AbsoluteConsistency))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	want := uint64(31)
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.LSN() != want {
+			t.Fatalf("expected LSN %d, got %d", want, l.LSN())
+		}
+		want++
+	}
+	if want != 61 {
+		t.Fatalf("replay stopped at %d", want-1)
+	}
+}
+
+func TestCheckpointKeepsDamagedSegment(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     int64
+		checkpoint uint64
+	}{
+		// Intact records follow the damage.
+		{"middle", 1, 3},
+		// The damage hides LSN 3, the last in the segment.
+		{"end", 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opt := WithMaxSegmentSize(HeaderSize + 3*50)
+			size := writeKeys(t, dir, 10, opt)
+
+			data := readSegment(t, dir, 1)
+			if int64(len(data)) != HeaderSize+3*size {
+				t.Fatalf("expected three records in the first segment, got %d bytes", len(data))
+			}
+			data[HeaderSize+(tt.record+1)*size-1] ^= 0xFF
+			if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := NewWALWriter(1, dir, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if err := w.Checkpoint(tt.checkpoint); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(segmentPath(dir, 1)); err != nil {
+				t.Fatalf("damaged segment was removed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package wal
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+// stepClock hands out next and moves it on by step each time.
+type stepClock struct {
+	next time.Time
+	step time.Duration
+}
+
+func (c *stepClock) Now() int64 {
+	ts := c.next.UnixNano()
+	c.next = c.next.Add(c.step)
+	return ts
+}
+
+func TestEncodeDecodeTimestamp(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 42, time.UTC)
+
+	b := NewBatch()
+	b.Put([]byte("a"), []byte("1"))
+	b.Delete([]byte("b"))
+
+	for _, l := range []*Log{NewLog(types.OperationPut, []byte("k"), []byte("v")), b.Log()} {
+		l.setLSN(9)
+		l.setTimestamp(at.UnixNano())
+
+		data, err := l.AppendEncode(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LSN() != 9 || !got.Timestamp().Equal(at) {
+			t.Fatalf("decoded LSN %d at %v", got.LSN(), got.Timestamp())
+		}
+		for _, op := range got.Batch() {
+			if !op.Timestamp().Equal(at) {
+				t.Fatalf("batch operation stamped %v", op.Timestamp())
+			}
+		}
+	}
+
+	got, err := DecodeBytes(mustEncode(t, NewLog(types.OperationPut, []byte("k"), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Timestamp().IsZero() {
+		t.Fatalf("unstamped record decoded at %v", got.Timestamp())
+	}
+}
+
+func mustEncode(t *testing.T, l *Log) []byte {
+	t.Helper()
+	data, err := l.AppendEncode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestHybridClock(t *testing.T) {
+	c := NewHybridClock()
+
+	prev := c.Now()
+	for range 1000 {
+		ts := c.Now()
+		if ts <= prev {
+			t.Fatalf("clock went from %d to %d", prev, ts)
+		}
+		prev = ts
+	}
+
+	future := time.Now().Add(time.Hour).UnixNano()
+	c.Observe(future)
+	c.Observe(prev)
+	if ts := c.Now(); ts != future+1 {
+		t.Fatalf("expected %d after observing %d, got %d", future+1, future, ts)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	w, err := NewWALWriter(1, dir, WithClock(&stepClock{next: base, step: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	r, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	from, to := base.Add(5*time.Minute), base.Add(10*time.Minute)
+	tests := []struct {
+		name string
+		seq  func() iter.Seq2[Log, error]
+		want []uint64
+	}{
+		{"iter", func() iter.Seq2[Log, error] { return r.IterBetween(from, to) }, []uint64{6, 7, 8, 9, 10}},
+		{"backward", func() iter.Seq2[Log, error] { return Between(r.Backward(), from, to) }, []uint64{10, 9, 8, 7, 6}},
+		{"open start", func() iter.Seq2[Log, error] { return Between(r.Backward(), time.Time{}, base.Add(2*time.Minute)) }, []uint64{2, 1}},
+		{"open end", func() iter.Seq2[Log, error] { return Between(r.Backward(), base.Add(18*time.Minute), time.Time{}) }, []uint64{20, 19}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Reset(); err != nil {
+				t.Fatal(err)
+			}
+
+			var lsns []uint64
+			for l, err := range tt.seq() {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := base.Add(time.Duration(l.LSN()-1) * time.Minute); !l.Timestamp().Equal(want) {
+					t.Fatalf("LSN %d stamped %v, want %v", l.LSN(), l.Timestamp(), want)
+				}
+				lsns = append(lsns, l.LSN())
+			}
+			if fmt.Sprint(lsns) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %v, want %v", lsns, tt.want)
+			}
+		})
+	}
+}
+
+func TestHybridClockFollowsLog(t *testing.T) {
+	dir := t.TempDir()
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	w, err := NewWALWriter(1, dir, WithClock(NewHybridClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLog(types.OperationPut, []byte("replicated"), nil)
+	l.setLSN(1)
+	l.setTimestamp(future)
+	if err := w.Append(l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Timestamp().UnixNano() != future {
+		t.Fatalf("appended record restamped at %v", l.Timestamp())
+	}
+	w.Close()
+
+	// A new clock picks up from the newest timestamp in the log.
+	w, err = NewWALWriter(1, dir, WithClock(NewHybridClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l = NewLog(types.OperationPut, []byte("local"), nil)
+	if _, err := w.Write(l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Timestamp().UnixNano() <= future {
+		t.Fatalf("expected a timestamp after %d, got %d", future, l.Timestamp().UnixNano())
+	}
+}
+
+func TestWriteRestampsRecord(t *testing.T) {
+	stale := time.Now().Add(-time.Hour).UnixNano()
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	tests := []struct {
+		name  string
+		clock Clock
+	}{
+		{"wall clock", WallClock()},
+		{"hybrid clock", NewHybridClock()},
+		{"no clock", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWALWriter(1, t.TempDir(), WithClock(tt.clock))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			for _, ts := range []int64{stale, future} {
+				// A decoded record, or one being reused, written again.
+				l := NewLog(types.OperationPut, []byte("k"), nil)
+				l.setTimestamp(ts)
+				before := time.Now().UnixNano()
+				if _, err := w.Write(l); err != nil {
+					t.Fatal(err)
+				}
+
+				got := l.Timestamp().UnixNano()
+				if tt.clock == nil {
+					if !l.Timestamp().IsZero() {
+						t.Fatalf("record kept %v without a clock", l.Timestamp())
+					}
+					continue
+				}
+				if got < before || got >= future {
+					t.Fatalf("record written at %d kept timestamp %d", before, got)
+				}
+			}
+
+			// The hybrid clock never saw the future timestamp.
+			l := NewLog(types.OperationPut, []byte("next"), nil)
+			if _, err := w.Write(l); err != nil {
+				t.Fatal(err)
+			}
+			if tt.clock != nil && l.Timestamp().UnixNano() >= future {
+				t.Fatalf("clock moved to %d", l.Timestamp().UnixNano())
+			}
+		})
+	}
+}
+
+func TestWithoutClock(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir(), WithClock(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	l := NewLog(types.OperationPut, []byte("k"), nil)
+	if _, err := w.Write(l); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Timestamp().IsZero() {
+		t.Fatalf("record stamped %v without a clock", l.Timestamp())
+	}
+}
+
+func TestHybridClockAfterEmptySegment(t *testing.T) {
+	dir := t.TempDir()
+	future := time.Now().Add(time.Hour).UnixNano()
+
+	w, err := NewWALWriter(1, dir, WithClock(NewHybridClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLog(types.OperationPut, []byte("replicated"), nil)
+	l.setLSN(1)
+	l.setTimestamp(future)
+	if err := w.Append(l); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// A crash right after rotation leaves a newest segment with only a header.
+	if err := os.WriteFile(segmentPath(dir, 2), readSegment(t, dir, 1)[:HeaderSize], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = NewWALWriter(1, dir, WithClock(NewHybridClock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l = NewLog(types.OperationPut, []byte("local"), nil)
+	lsn, err := w.Write(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 2 || l.Timestamp().UnixNano() <= future {
+		t.Fatalf("expected LSN 2 after %d, got LSN %d at %d", future, lsn, l.Timestamp().UnixNano())
+	}
+}
@@ -0,0 +1,197 @@
+package wal
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Compressed records set recordFlagCompressed in TYPE and replace the body
+// after the LSN with:
+// | CODEC (1) | RAW_LEN (4) | COMPRESSED BODY |
+// The CRC covers the compressed bytes.
+
+// CodecFlate is the ID of the compress/flate codec, which is always
+// registered.
+const CodecFlate = 1
+
+var ErrUnknownCodec = fmt.Errorf("unknown WAL compression codec")
+
+// Codec compresses record bodies. Codecs are identified on disk by their ID,
+// so a codec must be registered under the same ID wherever its records are
+// read.
+type Codec interface {
+	ID() byte
+	// Compress appends the compressed form of src to dst.
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress appends the decompressed form of src to dst.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{}
+)
+
+func init() {
+	RegisterCodec(NewFlateCodec(flate.DefaultCompression))
+}
+
+// RegisterCodec makes c available for decoding records that name its ID. It
+// panics if the ID is 0 or already taken.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if c.ID() == 0 {
+		panic("wal: codec ID 0 is reserved")
+	}
+	if _, dup := codecs[c.ID()]; dup {
+		panic(fmt.Sprintf("wal: codec %d registered twice", c.ID()))
+	}
+
+	codecs[c.ID()] = c
+}
+
+func lookupCodec(id byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCodec, id)
+	}
+
+	return c, nil
+}
+
+// WithCompression compresses the body of every record of at least threshold
+// bytes with c. Records that do not shrink are stored uncompressed. Readers
+// detect and decompress compressed records on their own.
+func WithCompression(c Codec, threshold int) Option {
+	return func(cfg *config) {
+		cfg.codec = c
+		cfg.compressThreshold = threshold
+	}
+}
+
+type flateCodec struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewFlateCodec returns a compress/flate codec at the given level. Every
+// level shares CodecFlate, since the decoder does not depend on it.
+func NewFlateCodec(level int) Codec {
+	return &flateCodec{level: level}
+}
+
+func (c *flateCodec) ID() byte {
+	return CodecFlate
+}
+
+// appendWriter is an io.Writer that appends to a byte slice.
+type appendWriter struct {
+	buf []byte
+}
+
+func (a *appendWriter) Write(p []byte) (int, error) {
+	a.buf = append(a.buf, p...)
+	return len(p), nil
+}
+
+func (c *flateCodec) Compress(dst, src []byte) ([]byte, error) {
+	out := &appendWriter{buf: dst}
+
+	fw, _ := c.writers.Get().(*flate.Writer)
+	if fw == nil {
+		var err error
+		if fw, err = flate.NewWriter(out, c.level); err != nil {
+			return dst, err
+		}
+	} else {
+		fw.Reset(out)
+	}
+	defer c.writers.Put(fw)
+
+	if _, err := fw.Write(src); err != nil {
+		return dst, err
+	}
+	if err := fw.Close(); err != nil {
+		return dst, err
+	}
+
+	return out.buf, nil
+}
+
+func (c *flateCodec) Decompress(dst, src []byte) ([]byte, error) {
+	in := bytes.NewReader(src)
+
+	fr, _ := c.readers.Get().(io.ReadCloser)
+	if fr == nil {
+		fr = flate.NewReader(in)
+	} else if err := fr.(flate.Resetter).Reset(in, nil); err != nil {
+		return dst, err
+	}
+	defer c.readers.Put(fr)
+
+	out := &appendWriter{buf: dst}
+	if _, err := io.Copy(out, fr); err != nil {
+		return dst, err
+	}
+
+	return out.buf, nil
+}
+
+// compressBody appends the compressed form of body to dst, prefixed with the
+// codec and raw length. It reports false, leaving dst untouched, if
+// compression is disabled, body is below the threshold or it did not shrink.
+func (e *encoder) compressBody(dst, body []byte) ([]byte, bool, error) {
+	if e.codec == nil || len(body) < e.compressThreshold {
+		return dst, false, nil
+	}
+
+	out := append(dst, e.codec.ID())
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)))
+
+	out, err := e.codec.Compress(out, body)
+	if err != nil {
+		return dst, false, fmt.Errorf("failed to compress record: %w", err)
+	}
+
+	if len(out)-len(dst) >= len(body) {
+		return dst, false, nil
+	}
+
+	return out, true, nil
+}
+
+// decompressBody expands a compressed body into l's decompression buffer.
+func (l *Log) decompressBody(payload []byte) ([]byte, error) {
+	if len(payload) < 5 {
+		return nil, ErrCorruptWAL
+	}
+
+	codec, err := lookupCodec(payload[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rawLen := int(binary.LittleEndian.Uint32(payload[1:]))
+	if rawLen > MaxFramedEntrySize {
+		return nil, ErrCorruptWAL
+	}
+
+	out, err := codec.Decompress(slices.Grow(l.zbuf[:0], rawLen), payload[5:])
+	if err != nil || len(out) != rawLen {
+		return nil, ErrCorruptWAL
+	}
+	l.zbuf = out
+
+	return out, nil
+}
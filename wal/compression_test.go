@@ -0,0 +1,172 @@
+package wal
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func jsonValue(i int) []byte {
+	return bytes.Repeat(fmt.Appendf(nil, `{"id":%d,"status":"active","tags":["a","b","c"]},`, i), 20)
+}
+
+func TestCompressedRecordRoundTrip(t *testing.T) {
+	e := encoder{codec: NewFlateCodec(flate.BestSpeed), compressThreshold: 64}
+
+	l := NewLog(types.OperationPut, []byte("doc"), jsonValue(1))
+	l.setLSN(9)
+
+	buf, err := e.appendRecord(nil, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) >= l.encodedSize() {
+		t.Fatalf("record did not shrink: %d >= %d", len(buf), l.encodedSize())
+	}
+	if buf[8]&recordFlagCompressed == 0 {
+		t.Fatal("compressed flag not set")
+	}
+
+	got, err := Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LSN() != 9 || !bytes.Equal(got.Key(), l.Key()) || !bytes.Equal(got.Value(), l.Value()) {
+		t.Fatalf("mismatch after decompression: %v", got)
+	}
+}
+
+func TestCompressionSkipsSmallAndIncompressibleRecords(t *testing.T) {
+	e := encoder{codec: NewFlateCodec(flate.DefaultCompression), compressThreshold: 256}
+
+	random := make([]byte, 1024)
+	_, _ = rand.Read(random)
+
+	tests := []struct {
+		name string
+		log  *Log
+	}{
+		{"below threshold", NewLog(types.OperationPut, []byte("k"), bytes.Repeat([]byte("a"), 100))},
+		{"incompressible", NewLog(types.OperationPut, []byte("k"), random)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := e.appendRecord(nil, tt.log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf[8]&recordFlagCompressed != 0 {
+				t.Fatal("record should have been stored raw")
+			}
+			if len(buf) != tt.log.encodedSize() {
+				t.Fatalf("expected %d bytes, got %d", tt.log.encodedSize(), len(buf))
+			}
+		})
+	}
+}
+
+func TestWriterCompression(t *testing.T) {
+	plainDir, compressedDir := t.TempDir(), t.TempDir()
+
+	for _, dir := range []string{plainDir, compressedDir} {
+		var opts []Option
+		if dir == compressedDir {
+			opts = append(opts, WithCompression(NewFlateCodec(flate.DefaultCompression), 128))
+		}
+
+		w, err := NewWALWriter(1, dir, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 20 {
+			if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "doc-%d", i), jsonValue(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b := NewBatch()
+		b.Put([]byte("batched"), jsonValue(99))
+		b.Delete([]byte("doc-0"))
+		if _, err := w.WriteBatch(b); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+
+	plain, compressed := readSegment(t, plainDir, 1), readSegment(t, compressedDir, 1)
+	if len(compressed)*4 > len(plain) {
+		t.Fatalf("expected at least 4x compression, got %d -> %d bytes", len(plain), len(compressed))
+	}
+
+	for _, opts := range [][]ReaderOption{nil, {WithBufferReuse()}} {
+		reader, err := NewWALReader(compressedDir, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := 0
+		for l, err := range reader.Iter() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.IsBatch() {
+				if ops := l.Batch(); len(ops) != 2 || !bytes.Equal(ops[0].Value(), jsonValue(99)) {
+					t.Fatalf("batch mismatch: %v", ops)
+				}
+				continue
+			}
+			if !bytes.Equal(l.Value(), jsonValue(i)) {
+				t.Fatalf("record %d mismatch", i)
+			}
+			i++
+		}
+		if i != 20 {
+			t.Fatalf("expected 20 records, got %d", i)
+		}
+		_ = reader.Close()
+	}
+}
+
+// taggedCodec reuses flate under a different ID to stand in for a
+// third-party codec.
+type taggedCodec struct {
+	Codec
+	id byte
+}
+
+func (c taggedCodec) ID() byte { return c.id }
+
+func TestCustomCodec(t *testing.T) {
+	c := taggedCodec{Codec: NewFlateCodec(flate.BestSpeed), id: 200}
+	RegisterCodec(c)
+
+	e := encoder{codec: c}
+	l := NewLog(types.OperationPut, []byte("doc"), jsonValue(1))
+
+	buf, err := e.appendRecord(nil, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Value(), l.Value()) {
+		t.Fatal("value mismatch after decompression")
+	}
+
+	// Records naming a codec nobody registered cannot be read.
+	codecsMu.Lock()
+	delete(codecs, c.id)
+	codecsMu.Unlock()
+
+	if _, err := Decode(bytes.NewReader(buf)); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("expected ErrUnknownCodec, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// fileSet shares open WAL files between a reader and its cursors. Readers only
+// use them through ReadAt, so sharing a file does not share a position in it.
+type fileSet struct {
+	fs    vfs.FS
+	mu    sync.Mutex
+	files map[string]*sharedFile
+}
+
+type sharedFile struct {
+	f    vfs.File
+	refs int
+}
+
+func newFileSet(fsys vfs.FS) *fileSet {
+	return &fileSet{fs: fsys, files: make(map[string]*sharedFile)}
+}
+
+// open returns the file at path, opening it unless a cursor already has.
+func (s *fileSet) open(path string) (vfs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sf, ok := s.files[path]; ok {
+		sf.refs++
+		return sf.f, nil
+	}
+
+	f, err := vfs.Open(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = &sharedFile{f: f, refs: 1}
+
+	return f, nil
+}
+
+// release closes f once no cursor is using it.
+func (s *fileSet) release(f vfs.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sf, ok := s.files[f.Name()]
+	if !ok || sf.f != f {
+		return fmt.Errorf("release of unknown WAL file %s", f.Name())
+	}
+
+	if sf.refs--; sf.refs > 0 {
+		return nil
+	}
+	delete(s.files, f.Name())
+
+	return f.Close()
+}
+
+// Cursor returns a new reader over the same log, with the same options, that
+// starts at the first record and shares w's open files. Every cursor keeps its
+// own position, so cursors can be moved independently, with SeekTo for
+// example, and used from different goroutines at once. A single cursor, like
+// any reader, is not safe for concurrent use. Closing a cursor leaves the
+// others open.
+func (w *WALReader) Cursor() (*WALReader, error) {
+	c := &WALReader{dir: w.dir, cfg: w.cfg, handles: w.handles, keys: w.keys}
+	if err := c.Reset(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
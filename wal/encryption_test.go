@@ -0,0 +1,205 @@
+package wal
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+// writeEncrypted writes a document under each key to dir, encrypted with kp.
+func writeEncrypted(t *testing.T, dir string, kp KeyProvider, keys ...string) {
+	t.Helper()
+	logs := make([]*Log, len(keys))
+	for i, k := range keys {
+		logs[i] = NewLog(types.OperationPut, []byte(k), jsonValue(len(k)))
+	}
+	writeLogs(t, dir, logs, WithEncryption(kp), WithCompression(NewFlateCodec(flate.BestSpeed), 64))
+}
+
+// readEncrypted returns the keys read from dir with kp up to the first error.
+func readEncrypted(t *testing.T, dir string, kp KeyProvider) ([]string, error) {
+	t.Helper()
+	reader, err := NewWALReader(dir, WithKeyProvider(kp), WithRecoveryMode(AbsoluteConsistency))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			return keys, err
+		}
+		if !bytes.Equal(l.Value(), jsonValue(len(l.Key()))) {
+			t.Fatalf("value mismatch for %s", l.Key())
+		}
+		keys = append(keys, string(l.Key()))
+	}
+	return keys, nil
+}
+
+func TestEncryptedRecordRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	kp := NewStaticKeyProvider(1, map[uint32][]byte{1: testKey1})
+	writeEncrypted(t, dir, kp, "alpha", "beta")
+
+	data := readSegment(t, dir, 1)
+	if bytes.Contains(data, []byte("alpha")) || bytes.Contains(data, []byte(`"status"`)) {
+		t.Fatal("plaintext found on disk")
+	}
+	if data[HeaderSize+8]&recordFlagEncrypted == 0 {
+		t.Fatal("encrypted flag not set")
+	}
+
+	keys, err := readEncrypted(t, dir, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[alpha beta]" {
+		t.Fatalf("got %v", keys)
+	}
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	if _, err := reader.Read(); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey without a key provider, got %v", err)
+	}
+}
+
+func TestCodecWithKeys(t *testing.T) {
+	kp := NewStaticKeyProvider(1, map[uint32][]byte{1: testKey1})
+	withKeys := WithCodecKeys(kp)
+
+	l := NewLog(types.OperationPut, []byte("alpha"), jsonValue(5))
+	l.setLSN(3)
+	rec, err := l.AppendEncode(nil, withKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec[8]&recordFlagEncrypted == 0 || bytes.Contains(rec, []byte("alpha")) {
+		t.Fatal("record not sealed")
+	}
+
+	var buf bytes.Buffer
+	if err := l.Encode(&buf, withKeys); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Decode(&buf, withKeys); err != nil || string(got.Key()) != "alpha" || got.LSN() != 3 {
+		t.Fatalf("Decode returned %v, %v", got, err)
+	}
+
+	var got Log
+	if _, err := DecodeInto(bytes.NewReader(rec), &got, nil, withKeys); err != nil || !bytes.Equal(got.Value(), jsonValue(5)) {
+		t.Fatalf("DecodeInto returned %v, %v", &got, err)
+	}
+	if l, err := DecodeBytes(rec, withKeys); err != nil || string(l.Key()) != "alpha" {
+		t.Fatalf("DecodeBytes returned %v, %v", l, err)
+	}
+
+	// The same record read by a WALReader.
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithEncryption(kp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	appendToSegment(t, segmentPath(dir, 1), rec)
+	if keys, err := readEncrypted(t, dir, kp); err != nil || fmt.Sprint(keys) != "[alpha]" {
+		t.Fatalf("reader got %v, %v", keys, err)
+	}
+
+	if _, err := DecodeBytes(rec); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey without keys, got %v", err)
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEncrypted(t, dir, NewStaticKeyProvider(1, map[uint32][]byte{1: testKey1}), "a", "b")
+
+	// The reopened writer scans the tail sealed with the old key.
+	both := NewStaticKeyProvider(2, map[uint32][]byte{1: testKey1, 2: testKey2})
+	writeEncrypted(t, dir, both, "c")
+
+	keys, err := readEncrypted(t, dir, both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Fatalf("got %v", keys)
+	}
+
+	keys, err = readEncrypted(t, dir, NewStaticKeyProvider(2, map[uint32][]byte{2: testKey2}))
+	if !errors.Is(err, ErrUnknownKey) || len(keys) != 0 {
+		t.Fatalf("expected ErrUnknownKey for the retired key, got %v after %v", err, keys)
+	}
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	kp := NewStaticKeyProvider(1, map[uint32][]byte{1: testKey1})
+	writeEncrypted(t, dir, kp, "first", "second")
+
+	// Flip a ciphertext bit and fix up the CRC, as a deliberate edit would.
+	path := segmentPath(dir, 1)
+	data := readSegment(t, dir, 1)
+	rec := data[HeaderSize:]
+	totalLen := binary.LittleEndian.Uint32(rec[4:])
+	rec[4+totalLen-1] ^= 0x01
+	binary.LittleEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:4+totalLen]))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := readEncrypted(t, dir, kp)
+	if !errors.Is(err, ErrAuthentication) || !errors.Is(err, ErrCorruptWAL) {
+		t.Fatalf("expected an authentication failure, got %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("tampered record was replayed: %v", keys)
+	}
+}
+
+func TestEncryptionBindsLSN(t *testing.T) {
+	kp := NewStaticKeyProvider(7, map[uint32][]byte{7: testKey1})
+	e := encoder{keys: newKeyring(kp)}
+
+	l := NewLog(types.OperationPut, []byte("k"), []byte("v"))
+	l.setLSN(1)
+	buf, err := e.appendRecord(nil, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Log
+	if err := decodeRecord(buf, &got, checksum.Default, e.keys); err != nil || string(got.Value()) != "v" {
+		t.Fatalf("round trip failed: %v %v", err, got.String())
+	}
+
+	// Moving the body under another LSN must not authenticate.
+	binary.LittleEndian.PutUint64(buf[9:], 2)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	if err := decodeRecord(buf, &got, checksum.Default, e.keys); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("expected ErrAuthentication, got %v", err)
+	}
+}
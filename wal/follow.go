@@ -0,0 +1,209 @@
+package wal
+
+import (
+	"context"
+	"io"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+const DefaultPollInterval = 50 * time.Millisecond
+
+// WithFollowWriter ties Follow to w, a writer for the same directory in this
+// process. Follow then wakes up as soon as w syncs and never yields a record
+// before w has synced it. Without it Follow polls the directory and yields
+// records once they are complete on disk, synced or not.
+func WithFollowWriter(w *WALWriter) ReaderOption {
+	return func(c *readerConfig) {
+		c.writer = w
+	}
+}
+
+// WithPollInterval sets how often Follow checks for new records when it is
+// not tied to a writer.
+func WithPollInterval(d time.Duration) ReaderOption {
+	return func(c *readerConfig) {
+		c.pollInterval = d
+	}
+}
+
+// DurableLSN returns the highest LSN known to be on stable storage.
+func (w *WALWriter) DurableLSN() uint64 {
+	return w.durableLSN.Load()
+}
+
+func (w *WALWriter) markDurable(lsn uint64) {
+	w.durableMu.Lock()
+	defer w.durableMu.Unlock()
+
+	if lsn <= w.durableLSN.Load() {
+		return
+	}
+	w.durableLSN.Store(lsn)
+	close(w.durableCh)
+	w.durableCh = make(chan struct{})
+}
+
+// waitDurable blocks until the durable LSN passes after. It returns
+// ErrWALClosed once the writer has shut down without getting there.
+func (w *WALWriter) waitDurable(ctx context.Context, after uint64) error {
+	for {
+		w.durableMu.Lock()
+		ch := w.durableCh
+		w.durableMu.Unlock()
+
+		if w.durableLSN.Load() > after {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-w.shutdown:
+			if w.durableLSN.Load() > after {
+				return nil
+			}
+			return ErrWALClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Follow yields every remaining record like Iter, but at the end of the log it
+// waits for more instead of stopping, moving on to new segments as the writer
+// rotates. A record still being written is never yielded. Follow ends without
+// an error when ctx is done, and with ErrWALClosed if the writer set by
+// WithFollowWriter is closed and everything it wrote has been yielded.
+func (w *WALReader) Follow(ctx context.Context) iter.Seq2[Log, error] {
+	return func(yield func(Log, error) bool) {
+		for ctx.Err() == nil {
+			log, err := w.read(true)
+			if err == nil {
+				if !yield(*log, nil) {
+					return
+				}
+				continue
+			}
+			if err != io.EOF {
+				if !yield(Log{}, err) || !w.resync {
+					return
+				}
+				continue
+			}
+
+			if err := w.wait(ctx); err != nil {
+				if err == ErrWALClosed {
+					yield(Log{}, err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// wait blocks until there may be more to read.
+func (w *WALReader) wait(ctx context.Context) error {
+	if wr := w.cfg.writer; wr != nil {
+		// Everything up to the durable LSN seen last time is already on disk,
+		// so wait for more unless the reader has yet to catch up with it.
+		after := w.seen
+		if d := wr.DurableLSN(); d > after && d == w.waited {
+			after = d
+		}
+		w.waited = wr.DurableLSN()
+		return wr.waitDurable(ctx, after)
+	}
+
+	timer := time.NewTimer(w.cfg.pollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh picks up segments created since the file list was read and reports
+// whether there were any. The current file's size is updated as well.
+func (w *WALReader) refresh() (bool, error) {
+	info, err := w.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	w.size = info.Size()
+
+	files, err := listWALFiles(w.cfg.fs, w.dir)
+	if err != nil {
+		return false, err
+	}
+
+	added := false
+	for _, f := range files {
+		if !slices.Contains(w.files, f) {
+			w.files = append(w.files, f)
+			added = true
+		}
+	}
+
+	return added, nil
+}
+
+// rewind repositions the reader at offset in the current file, so whatever
+// starts there is read again.
+func (w *WALReader) rewind(offset int64) error {
+	w.hasPending = false
+
+	if !w.hdr.framed() {
+		return w.seek(offset)
+	}
+
+	if err := w.blocks.seek(w.src, offset); err != nil {
+		return err
+	}
+	w.pos = offset
+
+	return nil
+}
+
+// caughtUp handles the end of the newest file in follow mode, where a torn
+// record may simply be one that is still being written. It rewinds to offset
+// and reports whether the reader has really caught up; if not, the writer has
+// moved on to a new segment and the file should be read again to its end.
+func (w *WALReader) caughtUp(offset int64) (bool, error) {
+	if err := w.rewind(offset); err != nil {
+		return false, err
+	}
+
+	added, err := w.refresh()
+	if err != nil {
+		return false, err
+	}
+
+	return !added, nil
+}
+
+// nextReady reports whether the file after the current one can be opened. A
+// segment the writer has only just created, or recycled, may not have its
+// header yet.
+func (w *WALReader) nextReady() bool {
+	if w.idx+2 < len(w.files) {
+		return true
+	}
+
+	f, err := vfs.Open(w.cfg.fs, w.files[w.idx+1])
+	if err != nil {
+		return true
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var magic [len(headerMagic)]byte
+	_, err = io.ReadFull(f, magic[:])
+	return err == nil && magic == headerMagic
+}
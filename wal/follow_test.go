@@ -0,0 +1,218 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+type followed struct {
+	key string
+	err error
+}
+
+// follow runs reader.Follow in the background and sends what it yields on
+// the returned channel, which is closed when Follow ends.
+func follow(ctx context.Context, reader *WALReader) <-chan followed {
+	out := make(chan followed, 100)
+	go func() {
+		defer close(out)
+		for l, err := range reader.Follow(ctx) {
+			out <- followed{key: string(l.Key()), err: err}
+		}
+	}()
+	return out
+}
+
+func expectKeys(t *testing.T, out <-chan followed, keys ...string) {
+	t.Helper()
+	for _, want := range keys {
+		select {
+		case got, ok := <-out:
+			if !ok {
+				t.Fatalf("follow ended while waiting for %s", want)
+			}
+			if got.err != nil {
+				t.Fatal(got.err)
+			}
+			if got.key != want {
+				t.Fatalf("got %s, want %s", got.key, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func expectNothing(t *testing.T, out <-chan followed) {
+	t.Helper()
+	select {
+	case got := <-out:
+		t.Fatalf("unexpected %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFollowWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	write := func(keys ...string) {
+		for _, k := range keys {
+			if _, err := w.Write(NewLog(types.OperationPut, []byte(k), []byte("value"))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write("a", "b")
+
+	reader, err := NewWALReader(dir, WithFollowWriter(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := follow(ctx, reader)
+	expectKeys(t, out, "a", "b")
+	expectNothing(t, out)
+
+	// Enough records to rotate through several segments.
+	var keys []string
+	for i := range 20 {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	write(keys...)
+	expectKeys(t, out, keys...)
+
+	cancel()
+	if got, ok := <-out; ok {
+		t.Fatalf("expected follow to end cleanly, got %+v", got)
+	}
+}
+
+func TestFollowHoldsBackUnsyncedRecords(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithSyncPolicy(SyncNever()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewWALReader(dir, WithFollowWriter(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("unsynced"), []byte("value"))); err != nil {
+		t.Fatal(err)
+	}
+
+	out := follow(context.Background(), reader)
+	expectNothing(t, out)
+
+	// Closing syncs the segment.
+	w.Close()
+	expectKeys(t, out, "unsynced")
+
+	got, ok := <-out
+	if !ok || !errors.Is(got.err, ErrWALClosed) {
+		t.Fatalf("expected ErrWALClosed, got %+v", got)
+	}
+}
+
+func TestFollowSkipsHalfWrittenRecord(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("framed=%v", framed), func(t *testing.T) {
+			dir := t.TempDir()
+			var opts []Option
+			if framed {
+				opts = append(opts, WithBlockFraming())
+			}
+			writeKeys(t, dir, 1, opts...)
+
+			reader, err := NewWALReader(dir, WithPollInterval(time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = reader.Close()
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out := follow(ctx, reader)
+			expectKeys(t, out, "key-0")
+
+			l := NewLog(types.OperationPut, []byte("late"), []byte("value"))
+			l.setLSN(2)
+			rec := encodeRecord(t, l)
+			if framed {
+				size := len(readSegment(t, dir, 1)) - HeaderSize
+				rec, _ = appendFragments(nil, rec, size%BlockSize, checksum.Default)
+			}
+
+			appendToSegment(t, segmentPath(dir, 1), rec[:len(rec)/2])
+			expectNothing(t, out)
+
+			appendToSegment(t, segmentPath(dir, 1), rec[len(rec)/2:])
+			expectKeys(t, out, "late")
+		})
+	}
+}
+
+func TestFollowPreallocatedAndRecycledSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(256), WithPreallocation(4096), WithSegmentRecycling(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	reader, err := NewWALReader(dir, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := follow(ctx, reader)
+
+	for round := range 3 {
+		var keys []string
+		for i := range 10 {
+			k := fmt.Sprintf("key-%d-%d", round, i)
+			if _, err := w.Write(NewLog(types.OperationPut, []byte(k), []byte("value"))); err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, k)
+		}
+		expectKeys(t, out, keys...)
+		expectNothing(t, out)
+
+		// Everything read so far can go, so later rounds reuse the files.
+		if err := w.Checkpoint(w.LastLSN()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r := reader.Report(); len(r.Dropped) != 0 {
+		t.Fatalf("follow dropped %+v", r.Dropped)
+	}
+}
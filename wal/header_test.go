@@ -0,0 +1,246 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+func TestWriterWritesFileHeader(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("k"), []byte("v")))
+	w.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, segmentmanager.SegmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, headerMagic[:]) {
+		t.Fatalf("segment does not start with magic: %q", data[:8])
+	}
+
+	f, hdr, err := openWALFile(vfs.OS(), filepath.Join(dir, segmentmanager.SegmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if hdr.version != FormatVersion || hdr.checksum != checksum.CRC32IEEE || hdr.created.IsZero() {
+		t.Fatalf("unexpected header %+v", hdr)
+	}
+
+	l, err := Decode(f)
+	if err != nil || string(l.Key()) != "k" {
+		t.Fatalf("first record after header: %v, %v", l, err)
+	}
+}
+
+func TestReaderRejectsForeignFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, segmentmanager.SegmentName(1))
+	if err := os.WriteFile(path, []byte("this is definitely not a write-ahead log"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALReader(dir); !errors.Is(err, ErrNotWAL) {
+		t.Fatalf("expected ErrNotWAL from reader, got %v", err)
+	}
+	if _, err := NewWALWriter(1, dir); !errors.Is(err, ErrNotWAL) {
+		t.Fatalf("expected ErrNotWAL from writer, got %v", err)
+	}
+}
+
+func TestReaderRejectsNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	if err := newFileHeader().encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	hdr := buf.Bytes()
+	binary.LittleEndian.PutUint16(hdr[8:10], FormatVersion+1)
+	binary.LittleEndian.PutUint32(hdr[28:32], crc32.ChecksumIEEE(hdr[:28]))
+
+	path := filepath.Join(dir, segmentmanager.SegmentName(1))
+	if err := os.WriteFile(path, hdr, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALReader(dir); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion from reader, got %v", err)
+	}
+	if _, err := NewWALWriter(1, dir); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion from writer, got %v", err)
+	}
+}
+
+func TestReaderRejectsUnknownHeaderFlags(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	hdr := newFileHeader()
+	hdr.flags = 0x80
+	if err := hdr.encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, segmentmanager.SegmentName(1)), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALReader(dir); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestReaderRejectsUnknownChecksum(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	hdr := newFileHeader()
+	hdr.checksum = 42
+	if err := hdr.encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, segmentmanager.SegmentName(1)), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALReader(dir); !errors.Is(err, ErrUnknownChecksum) {
+		t.Fatalf("expected ErrUnknownChecksum, got %v", err)
+	}
+}
+
+func TestWriterChecksumAlgorithms(t *testing.T) {
+	algorithms := []checksum.Algorithm{checksum.CRC32IEEE, checksum.CRC32C, checksum.XXHash64}
+
+	for _, framed := range []bool{false, true} {
+		dir := t.TempDir()
+
+		// Each writer finds the previous one's segment active, so its first
+		// record is checksummed for that segment and has to be redone when the
+		// segment manager rotates before writing it.
+		for i, alg := range algorithms {
+			opts := []Option{WithChecksum(alg), WithMaxSegmentSize(HeaderSize + 1)}
+			if framed {
+				opts = append(opts, WithBlockFraming())
+			}
+			w, err := NewWALWriter(1, dir, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := range 2 {
+				if _, err := w.Write(NewLog(types.OperationPut, []byte{byte('a' + 2*i + j)}, []byte("v"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Close()
+		}
+
+		// Without a rotation the active segment keeps its algorithm.
+		w, err := NewWALWriter(1, dir, WithChecksum(checksum.CRC32C))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(NewLog(types.OperationPut, []byte("g"), []byte("v"))); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		segments, err := segmentmanager.ListSegments(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []checksum.Algorithm
+		for _, s := range segments {
+			f, hdr, err := openWALFile(vfs.OS(), s.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = f.Close()
+			if hdr.framed() != framed {
+				t.Fatalf("%s: framed = %v", s.Path, hdr.framed())
+			}
+			got = append(got, hdr.checksum)
+		}
+		if len(got) != 6 || got[0] != checksum.CRC32IEEE || got[5] != checksum.XXHash64 {
+			t.Fatalf("framed=%v: segment algorithms %v", framed, got)
+		}
+
+		if keys := readKeys(t, dir); strings.Join(keys, "") != "abcdefg" {
+			t.Fatalf("framed=%v: read %v", framed, keys)
+		}
+	}
+}
+
+func TestReaderRejectsCorruptHeader(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	_ = newFileHeader().encode(&buf)
+	hdr := buf.Bytes()
+	hdr[12] ^= 0xFF
+
+	if err := os.WriteFile(filepath.Join(dir, segmentmanager.SegmentName(1)), hdr, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALReader(dir); !errors.Is(err, ErrCorruptWAL) {
+		t.Fatalf("expected ErrCorruptWAL, got %v", err)
+	}
+}
+
+func TestReaderAcceptsLegacySegment(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, segmentmanager.SegmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = NewLog(types.OperationPut, []byte("legacy"), []byte("1")).Encode(f)
+	_ = f.Close()
+
+	// The writer keeps appending self-describing records to the legacy file.
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("current"), []byte("2")))
+	w.Close()
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(l.Key()))
+	}
+	if len(keys) != 2 || keys[0] != "legacy" || keys[1] != "current" {
+		t.Fatalf("unexpected records %v", keys)
+	}
+}
@@ -0,0 +1,267 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// With WithOffsetIndex, the writer keeps a sidecar index next to every
+// segment, segment-0001.idx for segment-0001.log and so on, made of entries:
+// | LSN (8) | OFFSET (8) |
+// each giving the file offset where the record with that LSN starts, in
+// ascending order. The index is sparse and only a hint: it is not synced, and
+// a reader checks every entry it uses against the segment and falls back to
+// scanning the segment when the index is missing or wrong.
+
+const indexEntrySize = 16
+
+type indexEntry struct {
+	lsn    uint64
+	offset int64
+}
+
+// WithOffsetIndex keeps a sidecar index for each segment with an entry for
+// the first record at least interval bytes past the previous entry, so that
+// WALReader.SeekTo can jump close to any LSN. Smaller intervals mean shorter
+// scans after a seek and bigger index files. Zero, the default, writes no
+// index.
+func WithOffsetIndex(interval int64) Option {
+	return func(c *config) {
+		c.indexInterval = interval
+	}
+}
+
+// indexPath returns the path of the index for the log file at path.
+func indexPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".idx"
+}
+
+// readIndex returns the entries of the index at path, stopping at the first
+// entry that is out of order or torn. A missing index has no entries.
+func readIndex(fsys vfs.FS, path string) ([]indexEntry, error) {
+	data, err := vfs.ReadFile(fsys, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read WAL index: %w", err)
+	}
+
+	return parseIndex(data), nil
+}
+
+func parseIndex(data []byte) []indexEntry {
+	var entries []indexEntry
+	for ; len(data) >= indexEntrySize; data = data[indexEntrySize:] {
+		e := indexEntry{
+			lsn:    binary.LittleEndian.Uint64(data),
+			offset: int64(binary.LittleEndian.Uint64(data[8:])),
+		}
+		if n := len(entries); e.lsn == 0 || e.offset <= 0 || n > 0 && (e.lsn <= entries[n-1].lsn || e.offset <= entries[n-1].offset) {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// indexWriter appends to the index of the active segment. It is owned by the
+// writer loop.
+type indexWriter struct {
+	fs       vfs.FS
+	dir      string
+	interval int64
+	id       int
+	f        vfs.File
+	last     int64 // offset of the newest entry, -1 if there is none
+	buf      [indexEntrySize]byte
+}
+
+// add indexes the record lsn starting at offset in segment id if it is far
+// enough past the newest entry. A segment whose index cannot be written is
+// left without the rest of its entries.
+func (x *indexWriter) add(id int, offset int64, lsn uint64) error {
+	if id != x.id {
+		if err := x.open(id, offset); err != nil {
+			return err
+		}
+	}
+	if x.f == nil || x.last >= 0 && offset-x.last < x.interval {
+		return nil
+	}
+
+	binary.LittleEndian.PutUint64(x.buf[:], lsn)
+	binary.LittleEndian.PutUint64(x.buf[8:], uint64(offset))
+	if _, err := x.f.Write(x.buf[:]); err != nil {
+		_ = x.close()
+		return fmt.Errorf("failed to write WAL index: %w", err)
+	}
+	x.last = offset
+
+	return nil
+}
+
+// open switches to the index of segment id, whose records so far end at end.
+// Entries past end, left over from records a crash cut off, are dropped.
+func (x *indexWriter) open(id int, end int64) error {
+	if err := x.close(); err != nil {
+		return err
+	}
+	x.id = id
+
+	path := indexPath(filepath.Join(x.dir, segmentmanager.SegmentName(id)))
+	f, err := x.fs.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL index: %w", err)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to read WAL index: %w", err)
+	}
+	entries := parseIndex(data)
+	n := sort.Search(len(entries), func(i int) bool {
+		return entries[i].offset >= end
+	})
+
+	size := int64(n * indexEntrySize)
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to truncate WAL index: %w", err)
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to truncate WAL index: %w", err)
+	}
+
+	x.f, x.last = f, -1
+	if n > 0 {
+		x.last = entries[n-1].offset
+	}
+
+	return nil
+}
+
+func (x *indexWriter) close() error {
+	if x.f == nil {
+		return nil
+	}
+	err := x.f.Close()
+	x.f = nil
+	return err
+}
+
+// removeIndex deletes the index of the segment at path, if it has one.
+func removeIndex(fsys vfs.FS, path string) error {
+	if err := fsys.Remove(indexPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove WAL index: %w", err)
+	}
+	return nil
+}
+
+// SeekTo positions the reader so that the next Read returns the first record
+// with an LSN of at least lsn; records covered by the checkpoint are still
+// skipped. The reader finds the right file from the first record of each, then
+// jumps to the closest entry before lsn in the file's offset index, see
+// WithOffsetIndex, and reads forward from there. Without an index it reads
+// forward from the start of the file. Like Reset, SeekTo picks up files
+// created since the reader was opened.
+func (w *WALReader) SeekTo(lsn uint64) error {
+	if err := w.Reset(); err != nil {
+		return err
+	}
+	w.from = lsn
+
+	oldest := w.idx
+	for i := len(w.files) - 1; i > oldest; i-- {
+		first, err := w.firstLSN(i)
+		if err != nil {
+			return err
+		}
+		if first != 0 && first <= lsn {
+			return w.seekIndexed(lsn)
+		}
+	}
+
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	if err := w.openFrom(oldest); err != nil {
+		return err
+	}
+
+	return w.seekIndexed(lsn)
+}
+
+// firstLSN opens file idx and returns the LSN of its first record, or zero if
+// the file is gone, empty or starts with damage.
+func (w *WALReader) firstLSN(idx int) (uint64, error) {
+	if err := w.closeFile(); err != nil {
+		return 0, err
+	}
+	if err := w.open(idx); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	log, err := w.decode()
+	if err == nil {
+		return log.LSN(), nil
+	}
+	if err == io.EOF || errors.Is(err, ErrCorruptWAL) {
+		return 0, nil
+	}
+	return 0, err
+}
+
+// seekIndexed moves to the newest indexed record of the current file at or
+// below lsn, or to the first record if the index has none. An entry is only
+// used if the record it points at is intact and has the LSN it claims.
+func (w *WALReader) seekIndexed(lsn uint64) error {
+	start := w.hdr.size()
+	entries, err := readIndex(w.cfg.fs, indexPath(w.files[w.idx]))
+	if err != nil {
+		return err
+	}
+
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].lsn > lsn
+	})
+	for i--; i >= 0; i-- {
+		ok, err := w.checkEntry(entries[i])
+		if err != nil {
+			return err
+		}
+		if ok {
+			return w.rewind(entries[i].offset)
+		}
+	}
+
+	return w.rewind(start)
+}
+
+// checkEntry reports whether e points at an intact record of the current file
+// with the LSN e claims. It leaves the reader somewhere in the file.
+func (w *WALReader) checkEntry(e indexEntry) (bool, error) {
+	if e.offset < w.hdr.size() || e.offset >= w.size {
+		return false, nil
+	}
+	if err := w.rewind(e.offset); err != nil {
+		return false, err
+	}
+
+	log, err := w.decode()
+	return err == nil && log.LSN() == e.lsn, nil
+}
@@ -0,0 +1,237 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// seekAndCount seeks r to lsn and reads to the end, checking that the records
+// follow on from lsn. It returns how many there were.
+func seekAndCount(r *WALReader, lsn uint64) (int, error) {
+	if err := r.SeekTo(lsn); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		l, err := r.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if l.LSN() != lsn+uint64(n) {
+			return n, fmt.Errorf("record %d has LSN %d", n, l.LSN())
+		}
+		n++
+	}
+}
+
+func expectSeek(t *testing.T, r *WALReader, lsn uint64, want int) {
+	t.Helper()
+	n, err := seekAndCount(r, lsn)
+	if err != nil {
+		t.Fatalf("seek to %d: %v", lsn, err)
+	}
+	if n != want {
+		t.Fatalf("seek to %d: read %d records, want %d", lsn, n, want)
+	}
+}
+
+func TestSeekTo(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"no index", nil},
+		{"index", []Option{WithOffsetIndex(512)}},
+		{"framed index", []Option{WithOffsetIndex(512), WithBlockFraming()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeKeys(t, dir, 200, append([]Option{WithMaxSegmentSize(1 << 10)}, tt.opts...)...)
+
+			_, err := os.Stat(indexPath(segmentPath(dir, 2)))
+			if indexed := err == nil; indexed != (len(tt.opts) > 0) {
+				t.Fatalf("index present: %v", indexed)
+			}
+
+			r, err := NewWALReader(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = r.Close()
+			}()
+
+			// With an index the reader starts past the file's first record.
+			if err := r.SeekTo(150); err != nil {
+				t.Fatal(err)
+			}
+			if jumped := r.pos > r.hdr.size(); jumped != (len(tt.opts) > 0) {
+				t.Fatalf("jumped into the file: %v", jumped)
+			}
+
+			for _, lsn := range []uint64{150, 1, 37, 200, 201} {
+				expectSeek(t, r, lsn, 201-int(lsn))
+			}
+		})
+	}
+}
+
+func TestSeekToChecksIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 100, WithMaxSegmentSize(1<<10), WithOffsetIndex(256))
+
+	entries, err := readIndex(vfs.OS(), indexPath(segmentPath(dir, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 3 || entries[0].offset != HeaderSize {
+		t.Fatalf("unexpected index %v", entries)
+	}
+
+	// Point the last entry into the middle of its record and the one before
+	// at the wrong record.
+	data, err := os.ReadFile(indexPath(segmentPath(dir, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(entries) - 1
+	binary.LittleEndian.PutUint64(data[last*indexEntrySize+8:], uint64(entries[last].offset+3))
+	binary.LittleEndian.PutUint64(data[(last-1)*indexEntrySize:], entries[last-1].lsn+1)
+	if err := os.WriteFile(indexPath(segmentPath(dir, 1)), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	lsn := entries[last].lsn
+	expectSeek(t, r, lsn, 101-int(lsn))
+	if report := r.Report(); len(report.Dropped) != 0 {
+		t.Fatalf("damage reported while seeking: %+v", report)
+	}
+}
+
+func TestIndexDropsTruncatedEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 20, WithOffsetIndex(1))
+
+	entries, err := readIndex(vfs.OS(), indexPath(segmentPath(dir, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tear the last record, as a crash would.
+	if err := os.Truncate(segmentPath(dir, 1), entries[len(entries)-1].offset+5); err != nil {
+		t.Fatal(err)
+	}
+	writeKeys(t, dir, 5, WithOffsetIndex(1))
+
+	after, err := readIndex(vfs.OS(), indexPath(segmentPath(dir, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(entries)+4 {
+		t.Fatalf("expected %d entries, got %d", len(entries)+4, len(after))
+	}
+
+	r, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	expectSeek(t, r, 20, 5)
+}
+
+func TestCheckpointRemovesIndex(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir, WithMaxSegmentSize(512), WithOffsetIndex(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	var lsn uint64
+	for i := range 20 {
+		if lsn, err = w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k%d", i), make([]byte, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(indexPath(segmentPath(dir, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Checkpoint(lsn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(indexPath(segmentPath(dir, 1))); !os.IsNotExist(err) {
+		t.Fatalf("index of a removed segment left behind: %v", err)
+	}
+}
+
+func TestCursorsReadConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 300, WithOffsetIndex(512))
+
+	r, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		c, err := r.Cursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(lsn uint64) {
+			defer wg.Done()
+			defer func() {
+				_ = c.Close()
+			}()
+			n, err := seekAndCount(c, lsn)
+			if err == nil && n != 301-int(lsn) {
+				err = fmt.Errorf("read %d records", n)
+			}
+			errs[i] = err
+		}(uint64(1 + i*37))
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("cursor %d: %v", i, err)
+		}
+	}
+
+	// The cursors are closed but the reader still has its file.
+	expectSeek(t, r, 1, 300)
+	if len(r.handles.files) != 1 {
+		t.Fatalf("expected only the reader's file open, got %d", len(r.handles.files))
+	}
+}
@@ -0,0 +1,326 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
+)
+
+// tailRecovery describes the state of the log found by recoverTail.
+type tailRecovery struct {
+	lastLSN   uint64
+	lastTime  int64 // newest timestamp in the log
+	truncated int64
+	sealed    error // damage the newest segment was sealed over, if any
+
+	// Framing of the newest segment and, for a framed one, where the next
+	// fragment goes within its last block.
+	framed   bool
+	blockOff int
+	sum      checksum.Algorithm
+}
+
+// countingReader counts the bytes consumed from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// recoverTail prepares dir for appending. A crash can leave the newest segment
+// ending in a partial record or an InvalidCRC placeholder; readers stop there,
+// so anything appended after it would be unreachable. recoverTail cuts such a
+// torn tail off the newest segment and returns the highest LSN in the log.
+// Damage that intact records follow is not a torn tail. The segment is left
+// alone for readers to recover what they can, and appending carries on in a
+// new, empty segment.
+func recoverTail(fsys vfs.FS, dir string, keys *keyring) (tailRecovery, error) {
+	segments, err := segmentmanager.ListSegmentsFS(fsys, dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return tailRecovery{}, nil
+		}
+		return tailRecovery{}, fmt.Errorf("failed to list WAL segments: %w", err)
+	}
+	if len(segments) == 0 {
+		return tailRecovery{}, nil
+	}
+
+	newest := segments[len(segments)-1]
+	rec, err := truncateTornTail(fsys, newest.Path, keys)
+	if err != nil {
+		return tailRecovery{}, err
+	}
+	if rec.sealed != nil {
+		// The segment manager writes the header of an empty newest segment.
+		path := filepath.Join(dir, segmentmanager.SegmentName(newest.ID+1))
+		f, err := fsys.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return tailRecovery{}, fmt.Errorf("failed to seal damaged segment: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return tailRecovery{}, fmt.Errorf("failed to seal damaged segment: %w", err)
+		}
+		if err := fsys.SyncDir(dir); err != nil {
+			return tailRecovery{}, fmt.Errorf("failed to sync directory: %w", err)
+		}
+	}
+
+	// A crash just after rotation leaves the newest segment with only a
+	// header, so both the last LSN and the newest timestamp come from the
+	// newest segment that has records.
+	for i := len(segments) - 2; i >= 0 && rec.lastLSN == 0 && rec.lastTime == 0; i-- {
+		scan, err := scanSegment(fsys, segments[i].Path, keys)
+		if err != nil {
+			return tailRecovery{}, err
+		}
+		rec.lastLSN, rec.lastTime = scan.lastLSN, scan.lastTime
+	}
+
+	return rec, nil
+}
+
+// truncateTornTail cuts a torn tail off the segment at path. If the segment
+// has damage that intact records follow it is left unchanged and the damage
+// is returned in sealed instead.
+func truncateTornTail(fsys vfs.FS, path string, keys *keyring) (tailRecovery, error) {
+	f, err := fsys.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return tailRecovery{}, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return tailRecovery{}, err
+	}
+
+	hdr, err := readFileHeader(f)
+	if err != nil {
+		// A crash while the segment was being created can leave part of the
+		// header behind. The segment holds no records yet, so start it over.
+		if errors.Is(err, ErrCorruptWAL) && size < HeaderSize {
+			return tailRecovery{truncated: size}, truncateFile(f, 0)
+		}
+		return tailRecovery{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	scan, err := scanFile(f, hdr, size, keys)
+	if err != nil {
+		return tailRecovery{}, err
+	}
+	if scan.damage != nil {
+		return tailRecovery{
+			lastLSN:  scan.lastLSN,
+			lastTime: scan.lastTime,
+			// The same error a reader in TolerateCorruptedTail mode returns.
+			sealed: fmt.Errorf("%s: %w", filepath.Base(path), scan.damage),
+		}, nil
+	}
+
+	rec := tailRecovery{
+		lastLSN:  scan.lastLSN,
+		lastTime: scan.lastTime,
+		framed:   hdr.framed(),
+		sum:      hdr.checksum,
+	}
+	if scan.validEnd < size {
+		// Zero-filled space is preallocated, not torn.
+		zero, err := zeroFilled(f, scan.validEnd, size)
+		if err != nil {
+			return tailRecovery{}, err
+		}
+		if !zero {
+			rec.truncated = size - scan.validEnd
+		}
+		if err := truncateFile(f, scan.validEnd); err != nil {
+			return tailRecovery{}, err
+		}
+	}
+	if rec.framed {
+		rec.blockOff = int((scan.validEnd - hdr.size()) % BlockSize)
+	}
+
+	return rec, nil
+}
+
+// fileScan is what scanFile found in a WAL file.
+type fileScan struct {
+	records  int
+	lastLSN  uint64
+	lastTime int64
+	validEnd int64 // end of the last intact record
+
+	// damage is the first damage that intact records follow. Damage that
+	// runs to the end of the file is a torn tail and only sets torn.
+	damage *corruptionError
+	torn   bool
+}
+
+func (s *fileScan) add(l *Log, end int64) {
+	s.records++
+	s.lastLSN = max(s.lastLSN, l.LSN())
+	s.lastTime = max(s.lastTime, l.ts)
+	s.validEnd = end
+}
+
+// scanFile reads every intact record of the WAL file f, which is size bytes
+// long and has the header hdr. Damage is stepped over and measured the way a
+// reader does, so the damage it records is exactly what a reader in
+// TolerateCorruptedTail mode reports as ErrCorruptWAL.
+func scanFile(f vfs.File, hdr fileHeader, size int64, keys *keyring) (fileScan, error) {
+	if hdr.framed() {
+		return scanFramed(f, hdr, keys)
+	}
+	return scanUnframed(f, hdr, size, keys)
+}
+
+func scanUnframed(f vfs.File, hdr fileHeader, size int64, keys *keyring) (fileScan, error) {
+	s := fileScan{validEnd: hdr.size()}
+	var l Log
+	var buf []byte
+	for off := hdr.size(); off < size; {
+		cr := &countingReader{r: bufio.NewReaderSize(io.NewSectionReader(f, off, size-off), readBufferSize)}
+		pos := off
+		var err error
+		for {
+			if buf, err = decodeInto(cr, &l, buf, hdr.checksum, keys); err != nil {
+				break
+			}
+			pos = off + cr.n
+			s.add(&l, pos)
+		}
+		if err != io.EOF && !errors.Is(err, ErrCorruptWAL) {
+			return fileScan{}, fmt.Errorf("failed to scan %s: %w", filepath.Base(f.Name()), err)
+		}
+		if pos >= size {
+			break
+		}
+		if zero, zerr := zeroFilled(f, pos, size); zerr != nil || zero {
+			return s, zerr
+		}
+
+		next, nerr := nextValidRecord(f, pos+1, size, hdr.checksum, keys)
+		if nerr != nil {
+			return fileScan{}, nerr
+		}
+		s.torn = next == size
+		if !s.torn && s.damage == nil {
+			s.damage = &corruptionError{offset: pos, length: next - pos}
+			if err != io.EOF && err != ErrCorruptWAL {
+				s.damage.cause = err
+			}
+		}
+		off = next
+	}
+
+	return s, nil
+}
+
+// scanFramed reads a framed file. Damage is merged with any that directly
+// follows it, as the reader's measureDamage does.
+func scanFramed(f vfs.File, hdr fileHeader, keys *keyring) (fileScan, error) {
+	br := newBlockReader(f, hdr.size(), hdr.checksum)
+	s := fileScan{validEnd: hdr.size()}
+	var pending *corruptionError
+	var l Log
+	var buf []byte
+	for {
+		var err error
+		buf, err = br.next(buf[:0])
+		if err == nil {
+			err = decodeRecord(buf, &l, hdr.checksum, keys)
+			if err == nil {
+				if pending != nil && s.damage == nil {
+					s.damage = pending
+				}
+				pending = nil
+				s.add(&l, br.end)
+				continue
+			}
+			if errors.Is(err, ErrCorruptWAL) {
+				err = &corruptionError{offset: br.start, length: br.end - br.start, cause: err}
+			}
+		}
+		if err == io.EOF {
+			s.torn = pending != nil
+			return s, nil
+		}
+
+		ce, ok := err.(*corruptionError)
+		if !ok {
+			return fileScan{}, fmt.Errorf("failed to scan %s: %w", filepath.Base(f.Name()), err)
+		}
+		if pending == nil {
+			pending = ce
+		} else {
+			pending.length = ce.offset + ce.length - pending.offset
+		}
+	}
+}
+
+// zeroFilled reports whether the bytes [from, to) of r are all zero.
+func zeroFilled(r io.ReaderAt, from, to int64) (bool, error) {
+	if from >= to {
+		return true, nil
+	}
+
+	buf := make([]byte, min(to-from, readBufferSize))
+	for off := from; off < to; {
+		n, err := r.ReadAt(buf[:min(to-off, int64(len(buf)))], off)
+		if slices.ContainsFunc(buf[:n], func(b byte) bool { return b != 0 }) {
+			return false, nil
+		}
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("failed to read WAL tail: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		off += int64(n)
+	}
+	return true, nil
+}
+
+func truncateFile(f vfs.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate torn WAL tail: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync truncated WAL: %w", err)
+	}
+	return nil
+}
+
+// scanSegment runs scanFile over the WAL file at path without changing it.
+func scanSegment(fsys vfs.FS, path string, keys *keyring) (fileScan, error) {
+	f, hdr, err := openWALFile(fsys, path)
+	if err != nil {
+		return fileScan{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileScan{}, err
+	}
+
+	return scanFile(f, hdr, info.Size(), keys)
+}
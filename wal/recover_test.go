@@ -0,0 +1,297 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func appendToSegment(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func segmentPath(dir string, id int) string {
+	return filepath.Join(dir, segmentmanager.SegmentName(id))
+}
+
+func readSegment(t *testing.T, dir string, id int) []byte {
+	t.Helper()
+	data, err := os.ReadFile(segmentPath(dir, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encodeRecord(t *testing.T, l *Log) []byte {
+	t.Helper()
+	data, err := l.AppendEncode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readKeys(t *testing.T, dir string) []string {
+	t.Helper()
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(l.Key()))
+	}
+	return keys
+}
+
+func TestWriterTruncatesTornTail(t *testing.T) {
+	var placeholder bytes.Buffer
+	_ = binary.Write(&placeholder, binary.LittleEndian, InvalidCRC)
+	_ = binary.Write(&placeholder, binary.LittleEndian, uint32(40))
+	placeholder.WriteString("half a rec")
+
+	corrupt := encodeRecord(t, NewLog(types.OperationPut, []byte("torn"), []byte("value")))
+	corrupt[len(corrupt)-1] ^= 0xFF
+
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"partial record", []byte{0x01, 0x02, 0x03, 0x04, 0x05}},
+		{"invalid crc placeholder", placeholder.Bytes()},
+		{"checksum mismatch", corrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := NewWALWriter(1, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 3 {
+				_, _ = w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), nil))
+			}
+			w.Close()
+
+			appendToSegment(t, filepath.Join(dir, segmentmanager.SegmentName(1)), tt.tail)
+
+			w, err = NewWALWriter(1, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Stats().TruncatedTailBytes; got != int64(len(tt.tail)) {
+				t.Fatalf("expected %d truncated bytes, got %d", len(tt.tail), got)
+			}
+
+			lsn, err := w.Write(NewLog(types.OperationPut, []byte("after-crash"), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lsn != 4 {
+				t.Fatalf("expected LSN 4, got %d", lsn)
+			}
+			w.Close()
+
+			keys := readKeys(t, dir)
+			if len(keys) != 4 || keys[3] != "after-crash" {
+				t.Fatalf("record written after the crash is unreachable: %v", keys)
+			}
+		})
+	}
+}
+
+func TestWriterRestartsTornHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, segmentmanager.SegmentName(1))
+	if err := os.WriteFile(path, headerMagic[:6], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Stats().TruncatedTailBytes; got != 6 {
+		t.Fatalf("expected 6 truncated bytes, got %d", got)
+	}
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("k"), nil))
+	w.Close()
+
+	if keys := readKeys(t, dir); len(keys) != 1 {
+		t.Fatalf("unexpected records %v", keys)
+	}
+}
+
+func TestWriterKeepsCleanTail(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := NewWALWriter(1, dir)
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("k"), nil))
+	w.Close()
+
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if got := w.Stats().TruncatedTailBytes; got != 0 {
+		t.Fatalf("expected nothing truncated, got %d", got)
+	}
+}
+
+func TestPreallocatedTailIsNotTorn(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("framed=%v", framed), func(t *testing.T) {
+			dir, crashed := t.TempDir(), t.TempDir()
+			opts := []Option{WithPreallocation(1 << 20)}
+			if framed {
+				opts = append(opts, WithBlockFraming())
+			}
+
+			w, err := NewWALWriter(1, dir, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range []string{"a", "b", "c"} {
+				if _, err := w.Write(NewLog(types.OperationPut, []byte(k), []byte("value"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Copy the segment while the writer is still open, as a crash
+			// would leave it: records followed by reserved zeros.
+			data := readSegment(t, dir, 1)
+			w.Close()
+			if len(data) != 1<<20 {
+				t.Fatalf("expected 1MB reserved, got %d bytes", len(data))
+			}
+			if err := os.WriteFile(segmentPath(crashed, 1), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if len(readSegment(t, dir, 1)) == 1<<20 {
+				t.Fatal("Close left the reservation in place")
+			}
+
+			reader, err := NewWALReader(crashed, WithRecoveryMode(AbsoluteConsistency))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for l, err := range reader.Iter() {
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, string(l.Key()))
+			}
+			_ = reader.Close()
+			if fmt.Sprint(keys) != "[a b c]" {
+				t.Fatalf("got %v", keys)
+			}
+
+			w, err = NewWALWriter(1, crashed, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := w.Stats().TruncatedTailBytes; n != 0 {
+				t.Fatalf("reserved space reported as %d torn bytes", n)
+			}
+			if _, err := w.Write(NewLog(types.OperationPut, []byte("d"), []byte("value"))); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			if keys := readKeys(t, crashed); fmt.Sprint(keys) != "[a b c d]" {
+				t.Fatalf("got %v after reopening", keys)
+			}
+		})
+	}
+}
+
+func TestWriterRestartsZeroedSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	// A recycled segment renamed into place just before a crash.
+	if err := os.WriteFile(segmentPath(dir, 1), make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if keys := readKeys(t, dir); len(keys) != 0 {
+		t.Fatalf("expected no records, got %v", keys)
+	}
+
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("a"), []byte("value"))); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	if keys := readKeys(t, dir); fmt.Sprint(keys) != "[a]" {
+		t.Fatalf("got %v", keys)
+	}
+}
+
+func TestWriterKeepsRecordsAfterDamage(t *testing.T) {
+	dir := t.TempDir()
+	size := writeKeys(t, dir, 5)
+
+	data := readSegment(t, dir, 1)
+	data[HeaderSize+2*size+size-1] ^= 0xFF
+	if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every reopen carries on in a new segment.
+	for i, key := range []string{"after", "again"} {
+		w, err := NewWALWriter(1, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Stats().SealedDamage; i == 0 && !errors.Is(err, ErrCorruptWAL) || i == 1 && err != nil {
+			t.Fatalf("reopen %d: unexpected sealed damage %v", i, err)
+		}
+		lsn, err := w.Write(NewLog(types.OperationPut, []byte(key), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lsn != uint64(6+i) {
+			t.Fatalf("expected LSN %d, got %d", 6+i, lsn)
+		}
+		w.Close()
+	}
+
+	if !bytes.Equal(readSegment(t, dir, 1), data) {
+		t.Fatal("the damaged segment was changed")
+	}
+	if len(readSegment(t, dir, 2)) == 0 {
+		t.Fatal("no segment was started after the damaged one")
+	}
+	if keys, _, _ := replay(t, dir, SkipCorrupted); fmt.Sprint(keys) != "[key-0 key-1 key-3 key-4 after again]" {
+		t.Fatalf("got %v", keys)
+	}
+}
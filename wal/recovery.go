@@ -0,0 +1,315 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+)
+
+// RecoveryMode decides what a WALReader does with damaged data.
+type RecoveryMode int
+
+const (
+	// TolerateCorruptedTail drops damage that runs to the end of a file, such
+	// as a record torn by a crash, and reports anything else as ErrCorruptWAL.
+	// The caller may keep reading past such an error.
+	TolerateCorruptedTail RecoveryMode = iota
+	// AbsoluteConsistency reports any damage, including a torn tail, as
+	// ErrCorruptWAL.
+	AbsoluteConsistency
+	// PointInTime stops at the first damage and drops everything after it, so
+	// what is replayed is a consistent prefix of the log.
+	PointInTime
+	// SkipCorrupted drops damaged records and replays everything else.
+	SkipCorrupted
+)
+
+func (m RecoveryMode) String() string {
+	switch m {
+	case TolerateCorruptedTail:
+		return "tolerate corrupted tail"
+	case AbsoluteConsistency:
+		return "absolute consistency"
+	case PointInTime:
+		return "point in time"
+	case SkipCorrupted:
+		return "skip corrupted"
+	}
+	return fmt.Sprintf("RecoveryMode(%d)", int(m))
+}
+
+// WithRecoveryMode sets how the reader handles damaged data. The default is
+// TolerateCorruptedTail.
+func WithRecoveryMode(m RecoveryMode) ReaderOption {
+	return func(c *readerConfig) {
+		c.recoveryMode = m
+	}
+}
+
+// DroppedRange is a stretch of a WAL file that the reader did not replay.
+type DroppedRange struct {
+	File   string
+	Offset int64
+	Length int64
+
+	// Records counts the intact records in the range, which PointInTime drops
+	// along with the damage in front of them. Damaged records are not
+	// counted, since their boundaries cannot be trusted.
+	Records int
+
+	// Tail is set if the range runs to the end of the file.
+	Tail bool
+}
+
+// RecoveryReport summarizes what a WALReader replayed and dropped.
+type RecoveryReport struct {
+	Mode    RecoveryMode
+	Records int
+	Dropped []DroppedRange
+}
+
+// DroppedBytes returns the total length of the dropped ranges.
+func (r RecoveryReport) DroppedBytes() int64 {
+	var n int64
+	for _, d := range r.Dropped {
+		n += d.Length
+	}
+	return n
+}
+
+// DroppedRecords returns how many intact records were dropped.
+func (r RecoveryReport) DroppedRecords() int {
+	var n int
+	for _, d := range r.Dropped {
+		n += d.Records
+	}
+	return n
+}
+
+// corruptionError describes damaged bytes in a WAL file.
+type corruptionError struct {
+	offset, length int64
+	tail           bool
+	cause          error // wraps ErrCorruptWAL with more detail, if known
+}
+
+func (e *corruptionError) Error() string {
+	return fmt.Sprintf("%d bytes at offset %d: %v", e.length, e.offset, e.Unwrap())
+}
+
+func (e *corruptionError) Unwrap() error {
+	if e.cause != nil {
+		return e.cause
+	}
+	return ErrCorruptWAL
+}
+
+// Report returns what the reader has replayed and dropped since it was opened
+// or last Reset.
+func (w *WALReader) Report() RecoveryReport {
+	r := w.report
+	r.Dropped = append([]DroppedRange(nil), r.Dropped...)
+	return r
+}
+
+// recover applies the recovery mode to damage the reader has just stepped
+// over. A nil error means reading goes on.
+func (w *WALReader) recover(ce *corruptionError) error {
+	d := DroppedRange{
+		File:   filepath.Base(w.files[w.idx]),
+		Offset: ce.offset,
+		Length: ce.length,
+		Tail:   ce.tail,
+	}
+	err := fmt.Errorf("%s: %w", d.File, ce)
+
+	switch w.cfg.recoveryMode {
+	case SkipCorrupted:
+		w.report.Dropped = append(w.report.Dropped, d)
+		return nil
+	case PointInTime:
+		w.dropRest(d)
+		return nil
+	case TolerateCorruptedTail:
+		w.report.Dropped = append(w.report.Dropped, d)
+		if ce.tail {
+			return nil
+		}
+		w.resync = true
+		return err
+	default:
+		w.report.Dropped = append(w.report.Dropped, d)
+		return err
+	}
+}
+
+// dropRest drops everything from d onwards, counting the intact records that
+// are lost with it, and stops the reader.
+func (w *WALReader) dropRest(d DroppedRange) {
+	w.stopped = true
+
+	d.Length, d.Tail = w.size-d.Offset, true
+	d.Records = w.countRemaining()
+	w.report.Dropped = append(w.report.Dropped, d)
+
+	for w.nextFile() == nil {
+		w.report.Dropped = append(w.report.Dropped, DroppedRange{
+			File:    filepath.Base(w.files[w.idx]),
+			Offset:  w.hdr.size(),
+			Length:  w.size - w.hdr.size(),
+			Records: w.countRemaining(),
+			Tail:    true,
+		})
+	}
+}
+
+// countRemaining counts the intact records left in the current file that
+// have not been checkpointed.
+func (w *WALReader) countRemaining() int {
+	n := 0
+	for {
+		log, err := w.decode()
+		if err == nil {
+			if w.checkpoint == 0 || log.LSN() > w.checkpoint {
+				n++
+			}
+			continue
+		}
+		if _, ok := err.(*corruptionError); ok {
+			continue
+		}
+		return n
+	}
+}
+
+// skipDamage moves an unframed reader from the damaged record at w.pos to the
+// next offset where a valid record starts, or to the end of the file. cause is
+// the decode error for the record.
+func (w *WALReader) skipDamage(cause error) error {
+	next, err := w.scanForward(w.pos + 1)
+	if err != nil {
+		return err
+	}
+
+	ce := &corruptionError{offset: w.pos, length: next - w.pos, tail: next == w.size}
+	if cause != io.EOF && cause != ErrCorruptWAL {
+		ce.cause = cause
+	}
+	if err := w.seek(next); err != nil {
+		return err
+	}
+
+	return ce
+}
+
+// scanForward returns the first offset at or after from where a complete
+// record with a valid checksum starts, or the file size if there is none.
+func (w *WALReader) scanForward(from int64) (int64, error) {
+	return nextValidRecord(w.f, from, w.size, w.hdr.checksum, w.keys)
+}
+
+// scanWindow is how much of a file nextValidRecord reads at a time.
+const scanWindow = 64 << 10
+
+// nextValidRecord returns the first offset in [from, size) of the unframed
+// file r where an intact record starts, or size if there is none. Unframed
+// files have no sync points, so this tries every byte. The file is read in
+// windows of scanWindow, each overlapping the last by a record header, and a
+// checksum is only computed for a plausible header whose length fits the rest
+// of the file.
+func nextValidRecord(r io.ReaderAt, from, size int64, sum checksum.Algorithm, keys *keyring) (int64, error) {
+	if from >= size {
+		return size, nil
+	}
+
+	win := make([]byte, min(scanWindow, size-from))
+	var rec []byte // a record that runs past the window
+	var l Log
+	for start := from; ; {
+		n := int(min(int64(len(win)), size-start))
+		if _, err := r.ReadAt(win[:n], start); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to scan for the next WAL record: %w", err)
+		}
+
+		last := start+int64(n) == size
+		for i := 0; i+recordHeaderSize <= n; i++ {
+			off := start + int64(i)
+			totalLen, ok := plausibleRecord(win[i:i+recordHeaderSize], size-off)
+			if !ok {
+				continue
+			}
+
+			b := win[i:n]
+			if need := 4 + int(totalLen); need > len(b) {
+				rec = slices.Grow(rec[:0], need)[:need]
+				if _, err := r.ReadAt(rec, off); err != nil && err != io.EOF {
+					return 0, fmt.Errorf("failed to scan for the next WAL record: %w", err)
+				}
+				b = rec
+			}
+			if validRecordAt(b, &l, sum, keys) {
+				return off, nil
+			}
+		}
+		if last {
+			return size, nil
+		}
+
+		// The next window starts with the first offset whose header did not
+		// fit in this one.
+		start += int64(max(n-recordHeaderSize+1, 1))
+	}
+}
+
+// recordHeaderSize covers the CRC, TOTAL_LEN and TYPE of a record.
+const recordHeaderSize = 9
+
+// plausibleRecord reports whether the record header hdr could start a record
+// with rest bytes left in the file, and returns its TOTAL_LEN.
+func plausibleRecord(hdr []byte, rest int64) (uint32, bool) {
+	storedCRC := binary.LittleEndian.Uint32(hdr)
+	totalLen := binary.LittleEndian.Uint32(hdr[4:])
+	if storedCRC == InvalidCRC || totalLen > MaxEntrySize || int64(totalLen) > rest-4 {
+		return 0, false
+	}
+
+	typ := hdr[8]
+	if typ&recordOpMask > recordKindBatch {
+		return 0, false
+	}
+	minLen := uint32(1 + 4) // TYPE and a KEY_LEN or COUNT
+	if typ&recordFlagLSN != 0 {
+		minLen += 8
+	}
+	if typ&recordFlagTime != 0 {
+		minLen += 8
+	}
+	if totalLen < minLen {
+		return 0, false
+	}
+
+	return totalLen, true
+}
+
+// validRecordAt reports whether b starts with a complete, intact record.
+func validRecordAt(b []byte, l *Log, sum checksum.Algorithm, keys *keyring) bool {
+	if len(b) < recordHeaderSize {
+		return false
+	}
+
+	totalLen, ok := plausibleRecord(b, int64(len(b)))
+	if !ok {
+		return false
+	}
+
+	payload := b[4 : 4+totalLen]
+	if sum.Checksum(payload) != binary.LittleEndian.Uint32(b) {
+		return false
+	}
+
+	return l.decodePayload(payload[4:], keys) == nil
+}
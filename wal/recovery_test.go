@@ -0,0 +1,328 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+// writeLogs writes logs to dir through a WALWriter opened with opts.
+func writeLogs(t *testing.T, dir string, logs []*Log, opts ...Option) {
+	t.Helper()
+	w, err := NewWALWriter(1, dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, l := range logs {
+		if _, err := w.Write(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// puts returns a put of each value, under key-0, key-1, ...
+func puts(values ...[]byte) []*Log {
+	logs := make([]*Log, len(values))
+	for i, v := range values {
+		logs[i] = NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), v)
+	}
+	return logs
+}
+
+// writeKeys writes key-0, key-1, ... with equal sized records and returns the
+// size of one record.
+func writeKeys(t *testing.T, dir string, n int, opts ...Option) int64 {
+	t.Helper()
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = []byte("value")
+	}
+	logs := puts(values...)
+	writeLogs(t, dir, logs, opts...)
+
+	if n == 0 {
+		return 0
+	}
+	return int64(logs[n-1].encodedSize())
+}
+
+// replay reads dir in mode, carrying on past errors for as long as the reader
+// allows, and returns the keys and the number of errors seen.
+func replay(t *testing.T, dir string, mode RecoveryMode) ([]string, int, RecoveryReport) {
+	t.Helper()
+	reader, err := NewWALReader(dir, WithRecoveryMode(mode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	var errs int
+	for l, err := range reader.Iter() {
+		if err != nil {
+			if !errors.Is(err, ErrCorruptWAL) {
+				t.Fatal(err)
+			}
+			errs++
+			continue
+		}
+		keys = append(keys, string(l.Key()))
+	}
+
+	return keys, errs, reader.Report()
+}
+
+func TestRecoveryModes(t *testing.T) {
+	dir := t.TempDir()
+	size := writeKeys(t, dir, 6)
+
+	// Damage key-2 and leave half a record at the end.
+	data := readSegment(t, dir, 1)
+	data[HeaderSize+2*size+size-1] ^= 0xFF
+	torn := encodeRecord(t, NewLog(types.OperationPut, []byte("torn"), []byte("value")))
+	data = append(data, torn[:len(torn)/2]...)
+	if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	damaged := DroppedRange{File: "segment-0001.log", Offset: HeaderSize + 2*size, Length: size}
+	tail := DroppedRange{File: "segment-0001.log", Offset: HeaderSize + 6*size, Length: int64(len(torn) / 2), Tail: true}
+
+	tests := []struct {
+		mode    RecoveryMode
+		keys    []string
+		errs    int
+		dropped []DroppedRange
+	}{
+		{
+			mode:    TolerateCorruptedTail,
+			keys:    []string{"key-0", "key-1", "key-3", "key-4", "key-5"},
+			errs:    1,
+			dropped: []DroppedRange{damaged, tail},
+		},
+		{
+			mode:    AbsoluteConsistency,
+			keys:    []string{"key-0", "key-1"},
+			errs:    1,
+			dropped: []DroppedRange{damaged},
+		},
+		{
+			mode: PointInTime,
+			keys: []string{"key-0", "key-1"},
+			dropped: []DroppedRange{{
+				File:    "segment-0001.log",
+				Offset:  HeaderSize + 2*size,
+				Length:  int64(len(data)) - HeaderSize - 2*size,
+				Records: 3,
+				Tail:    true,
+			}},
+		},
+		{
+			mode:    SkipCorrupted,
+			keys:    []string{"key-0", "key-1", "key-3", "key-4", "key-5"},
+			dropped: []DroppedRange{damaged, tail},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			keys, errs, report := replay(t, dir, tt.mode)
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+				t.Fatalf("keys = %v, want %v", keys, tt.keys)
+			}
+			if errs != tt.errs {
+				t.Fatalf("expected %d errors, got %d", tt.errs, errs)
+			}
+			if fmt.Sprint(report.Dropped) != fmt.Sprint(tt.dropped) {
+				t.Fatalf("dropped = %+v, want %+v", report.Dropped, tt.dropped)
+			}
+			if report.Records != len(tt.keys) || report.Mode != tt.mode {
+				t.Fatalf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+func TestAbsoluteConsistencyRejectsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir, 2)
+
+	torn := encodeRecord(t, NewLog(types.OperationPut, []byte("torn"), []byte("value")))
+	appendToSegment(t, segmentPath(dir, 1), torn[:5])
+
+	keys, errs, report := replay(t, dir, AbsoluteConsistency)
+	if len(keys) != 2 || errs != 1 {
+		t.Fatalf("expected 2 keys and 1 error, got %v and %d", keys, errs)
+	}
+	if report.DroppedBytes() != 5 || !report.Dropped[0].Tail {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if keys, errs, _ := replay(t, dir, TolerateCorruptedTail); len(keys) != 2 || errs != 0 {
+		t.Fatalf("expected the torn tail to be tolerated, got %v and %d errors", keys, errs)
+	}
+}
+
+func TestPointInTimeDropsLaterSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	// Records just under a block each, three to a segment.
+	w, err := NewWALWriter(1, dir, WithBlockFraming(), WithMaxSegmentSize(3*BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := make([]byte, BlockSize-100)
+	for i := range 9 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	// Damage the second block of the first segment, which holds the end of
+	// key-1 and the start of key-2.
+	data := readSegment(t, dir, 1)
+	data[HeaderSize+BlockSize+100] ^= 0xFF
+	if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, errs, report := replay(t, dir, PointInTime)
+	if fmt.Sprint(keys) != "[key-0]" || errs != 0 {
+		t.Fatalf("expected only key-0 without errors, got %v and %d errors", keys, errs)
+	}
+	if got := report.DroppedRecords(); got != 6 {
+		t.Fatalf("expected 6 intact records dropped, got %d (%+v)", got, report.Dropped)
+	}
+	if len(report.Dropped) != 3 {
+		t.Fatalf("expected a range in each of 3 segments, got %+v", report.Dropped)
+	}
+
+	keys, errs, report = replay(t, dir, SkipCorrupted)
+	if len(keys) != 7 || errs != 0 || report.DroppedRecords() != 0 || len(report.Dropped) != 1 {
+		t.Fatalf("unexpected skip result: %v, %d errors, %+v", keys, errs, report)
+	}
+}
+
+func TestWriterRecoveryMatchesReader(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("framed=%v", framed), func(t *testing.T) {
+			dir := t.TempDir()
+			var opts []Option
+			if framed {
+				opts = append(opts, WithBlockFraming())
+			}
+			// Enough records to fill more than one block, since a framed
+			// reader drops the rest of a damaged block.
+			size := writeKeys(t, dir, 1000, opts...)
+			if framed {
+				size += fragmentHeaderSize
+			}
+
+			// Damage key-2, which intact records follow.
+			data := readSegment(t, dir, 1)
+			data[HeaderSize+3*size-1] ^= 0xFF
+			if err := os.WriteFile(segmentPath(dir, 1), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := NewWALReader(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var readErr error
+			for _, err := range reader.Iter() {
+				if err != nil {
+					readErr = err
+					break
+				}
+			}
+			_ = reader.Close()
+
+			w, err := NewWALWriter(1, dir, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Stats().SealedDamage
+			w.Close()
+			if !errors.Is(err, ErrCorruptWAL) || readErr == nil || err.Error() != readErr.Error() {
+				t.Fatalf("writer sealed %v, reader returned %v", err, readErr)
+			}
+			if !bytes.Equal(readSegment(t, dir, 1), data) {
+				t.Fatal("the segment was changed")
+			}
+		})
+	}
+}
+
+// sizedReaderAt records the largest read from r.
+type sizedReaderAt struct {
+	r       *bytes.Reader
+	largest int
+}
+
+func (s *sizedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.largest = max(s.largest, len(p))
+	return s.r.ReadAt(p, off)
+}
+
+func TestNextValidRecordReadsInWindows(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	garbage := make([]byte, 3*scanWindow+5)
+	for i := range garbage {
+		garbage[i] = byte(rng.Uint32())
+	}
+	small := encodeRecord(t, NewLog(types.OperationPut, []byte("small"), []byte("value")))
+	big := encodeRecord(t, NewLog(types.OperationPut, []byte("big"), make([]byte, 2*scanWindow)))
+
+	tests := []struct {
+		name   string
+		record []byte
+		at     int
+	}{
+		{"after several windows", small, len(garbage)},
+		{"across a window boundary", small, scanWindow - 3},
+		{"longer than a window", big, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := slices.Concat(garbage[:tt.at], tt.record, garbage[tt.at:])
+			r := &sizedReaderAt{r: bytes.NewReader(data)}
+
+			got, err := nextValidRecord(r, 1, int64(len(data)), checksum.Default, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != int64(tt.at) {
+				t.Fatalf("found a record at %d, want %d", got, tt.at)
+			}
+			// Without the record only garbage is left.
+			r = &sizedReaderAt{r: bytes.NewReader(garbage)}
+			if got, err := nextValidRecord(r, 0, int64(len(garbage)), checksum.Default, nil); err != nil || got != int64(len(garbage)) {
+				t.Fatalf("found a record at %d in garbage: %v", got, err)
+			}
+		})
+	}
+
+	// Zero-filled space, as preallocation leaves, is read a window at a time.
+	data := append(make([]byte, 4*scanWindow), small...)
+	r := &sizedReaderAt{r: bytes.NewReader(data)}
+	if got, err := nextValidRecord(r, 0, int64(len(data)), checksum.Default, nil); err != nil || got != 4*scanWindow {
+		t.Fatalf("found a record at %d: %v", got, err)
+	}
+	if r.largest > scanWindow {
+		t.Fatalf("read %d bytes at once", r.largest)
+	}
+}
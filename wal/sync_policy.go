@@ -0,0 +1,106 @@
+package wal
+
+import (
+	"fmt"
+	"time"
+)
+
+type syncMode int
+
+const (
+	syncAlways syncMode = iota
+	syncInterval
+	syncBytes
+	syncNever
+)
+
+// SyncPolicy decides when the writer fsyncs the active segment. Under any
+// policy other than SyncAlways, Write returns once the record has been handed
+// to the operating system, and a crash may lose records that were not yet
+// synced.
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+	bytes    int64
+}
+
+// SyncAlways fsyncs after every batch before acknowledging its writes.
+func SyncAlways() SyncPolicy {
+	return SyncPolicy{mode: syncAlways}
+}
+
+// SyncEvery fsyncs at most once per interval d, and at least once per
+// interval while there is unsynced data.
+func SyncEvery(d time.Duration) SyncPolicy {
+	return SyncPolicy{mode: syncInterval, interval: d}
+}
+
+// SyncEveryBytes fsyncs once at least n bytes have been written since the
+// previous fsync.
+func SyncEveryBytes(n int64) SyncPolicy {
+	return SyncPolicy{mode: syncBytes, bytes: n}
+}
+
+// SyncNever leaves flushing to the operating system. The log is only synced
+// when the writer is closed.
+func SyncNever() SyncPolicy {
+	return SyncPolicy{mode: syncNever}
+}
+
+// Bounded reports whether the policy syncs every record within a bounded time
+// without further writes, so DurableLSN catches up with the log on its own.
+// SyncAlways and SyncEvery do; SyncEveryBytes and SyncNever do not.
+func (p SyncPolicy) Bounded() bool {
+	return p.mode == syncAlways || p.mode == syncInterval
+}
+
+func (p SyncPolicy) String() string {
+	switch p.mode {
+	case syncAlways:
+		return "always"
+	case syncInterval:
+		return fmt.Sprintf("every %s", p.interval)
+	case syncBytes:
+		return fmt.Sprintf("every %d bytes", p.bytes)
+	case syncNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// WithSyncPolicy sets when the writer fsyncs. The default is SyncAlways.
+func WithSyncPolicy(p SyncPolicy) Option {
+	return func(c *config) {
+		c.syncPolicy = p
+	}
+}
+
+func (p SyncPolicy) validate() error {
+	switch {
+	case p.mode == syncInterval && p.interval <= 0:
+		return fmt.Errorf("sync interval must be positive, got %s", p.interval)
+	case p.mode == syncBytes && p.bytes <= 0:
+		return fmt.Errorf("sync byte threshold must be positive, got %d", p.bytes)
+	}
+	return nil
+}
+
+// shouldSync reports whether the policy wants an fsync now, given the bytes
+// written and the time elapsed since the previous one.
+func (p SyncPolicy) shouldSync(unsynced int64, sinceLast time.Duration) bool {
+	if unsynced == 0 {
+		return false
+	}
+
+	switch p.mode {
+	case syncAlways:
+		return true
+	case syncInterval:
+		return sinceLast >= p.interval
+	case syncBytes:
+		return unsynced >= p.bytes
+	default:
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+package wal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/types"
+)
+
+func TestSyncPolicyNever(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir(), WithSyncPolicy(SyncNever()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := range 10 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := w.Stats()
+	if stats.Syncs != 0 {
+		t.Fatalf("expected no fsyncs, got %d", stats.Syncs)
+	}
+	if stats.UnsyncedBytes == 0 {
+		t.Fatal("expected unsynced bytes to be tracked")
+	}
+	if stats.SyncPolicy.String() != "never" {
+		t.Fatalf("unexpected policy %s", stats.SyncPolicy)
+	}
+}
+
+func TestSyncPolicyBytes(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir(), WithSyncPolicy(SyncEveryBytes(100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	l := NewLog(types.OperationPut, []byte("key"), []byte("value"))
+	const N = 40
+	for range N {
+		if _, err := w.Write(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every perSync-th write crosses the threshold.
+	size := l.encodedSize()
+	perSync := (100 + size - 1) / size
+	stats := w.Stats()
+	if want := uint64(N / perSync); stats.Syncs != want {
+		t.Fatalf("expected %d fsyncs, got %d", want, stats.Syncs)
+	}
+	if stats.SyncPolicy.String() != "every 100 bytes" {
+		t.Fatalf("unexpected policy %s", stats.SyncPolicy)
+	}
+}
+
+func TestSyncPolicyInterval(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir(), WithSyncPolicy(SyncEvery(10*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("k"), []byte("v"))); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for w.Stats().UnsyncedBytes != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("interval policy never synced")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if stats := w.Stats(); stats.Syncs == 0 {
+		t.Fatal("expected a background fsync")
+	}
+}
+
+func TestSyncPolicyAlwaysIsDefault(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("k"), []byte("v")))
+
+	stats := w.Stats()
+	if stats.SyncPolicy.String() != "always" || stats.Syncs != 1 || stats.UnsyncedBytes != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSyncPolicyRejectsInvalid(t *testing.T) {
+	if _, err := NewWALWriter(1, t.TempDir(), WithSyncPolicy(SyncEvery(0))); err == nil {
+		t.Fatal("expected error for zero interval")
+	}
+	if _, err := NewWALWriter(1, t.TempDir(), WithSyncPolicy(SyncEveryBytes(-1))); err == nil {
+		t.Fatal("expected error for negative byte threshold")
+	}
+}
@@ -3,9 +3,11 @@ package wal
 import (
 	"encoding/binary"
 	"fmt"
-	"hash/crc32"
 	"io"
+	"slices"
+	"time"
 
+	"github.com/Priyanshu23/FlashLogGo/checksum"
 	"github.com/Priyanshu23/FlashLogGo/types"
 )
 
@@ -14,13 +16,46 @@ const (
 	MaxEntrySize = 16 << 20 // 16MB
 )
 
-var ErrCorruptWAL = fmt.Errorf("corrupt WAL")
+// The TYPE byte holds the record kind in its low bits and record flags in its
+// high bits. Records written before LSNs existed (v1) have no flags set. The
+// kinds 0 and 1 are the types.Operation values of a single Put or Delete.
+const (
+	recordOpMask         = 0x0F
+	recordKindBatch      = 0x02 // the body is a batch of operations
+	recordFlagLSN        = 0x80 // v2: an 8 byte LSN follows the TYPE byte
+	recordFlagCompressed = 0x40 // the body is compressed, see Codec
+	recordFlagEncrypted  = 0x20 // the body is sealed, see KeyProvider
+	recordFlagTime       = 0x10 // an 8 byte timestamp follows the LSN
+
+	recordKnownFlags = recordFlagLSN | recordFlagCompressed | recordFlagEncrypted | recordFlagTime
+)
+
+var (
+	ErrCorruptWAL       = fmt.Errorf("corrupt WAL")
+	ErrEntryTooLarge    = fmt.Errorf("entry too large")
+	ErrInvalidOperation = fmt.Errorf("operation is neither a Put nor a Delete")
+)
+
+// checkOp rejects operations the TYPE byte cannot hold, which would read back
+// as another record kind or as flags.
+func checkOp(op types.Operation) error {
+	if op != types.OperationPut && op != types.OperationDelete {
+		return fmt.Errorf("%w: %d", ErrInvalidOperation, op)
+	}
+	return nil
+}
 
 type Log struct {
 	op    types.Operation
+	lsn   uint64
+	ts    int64 // Unix nanoseconds, 0 if unstamped
 	key   []byte
 	value []byte
+	batch []*Log
 	crc   uint32
+
+	zbuf []byte // decompressed body, reused by DecodeInto
+	dbuf []byte // decrypted body, reused by DecodeInto
 }
 
 // NewLog creates a new WAL log entry.
@@ -37,6 +72,39 @@ func (l *Log) Op() types.Operation {
 	return l.op
 }
 
+// LSN returns the log sequence number assigned by the WALWriter, or 0 if the
+// record has not been written or predates LSNs.
+func (l *Log) LSN() uint64 {
+	return l.lsn
+}
+
+// setLSN assigns lsn to the record and, for a batch, to each of its
+// operations.
+func (l *Log) setLSN(lsn uint64) {
+	l.lsn = lsn
+	for _, op := range l.batch {
+		op.lsn = lsn
+	}
+}
+
+// Timestamp returns the time the WALWriter stamped on the record, see
+// WithClock, or the zero time if the record has none.
+func (l *Log) Timestamp() time.Time {
+	if l.ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, l.ts)
+}
+
+// setTimestamp stamps the record and, for a batch, each of its operations
+// with ts.
+func (l *Log) setTimestamp(ts int64) {
+	l.ts = ts
+	for _, op := range l.batch {
+		op.ts = ts
+	}
+}
+
 // Key returns the key bytes.
 func (l *Log) Key() []byte {
 	return l.key
@@ -48,86 +116,206 @@ func (l *Log) Value() []byte {
 }
 
 func (l *Log) String() string {
-	return fmt.Sprintf("[crc: ] [operation: %d] [key: %s] [value: %s]", l.op, l.key, l.value)
+	return fmt.Sprintf("[lsn: %d] [operation: %d] [key: %s] [value: %s]", l.lsn, l.op, l.key, l.value)
+}
+
+// encodedSize returns the number of bytes Encode writes for l.
+func (l *Log) encodedSize() int {
+	size := 4 + 4 + 1 + l.bodySize()
+	if l.lsn != 0 {
+		size += 8
+	}
+	if l.ts != 0 {
+		size += 8
+	}
+	return size
+}
+
+func (l *Log) bodySize() int {
+	if l.IsBatch() {
+		return l.batchBodySize()
+	}
+	return 4 + len(l.key) + 4 + len(l.value)
 }
 
 // Encode Binary format:
-// | CRC (4) | TOTAL_LEN (4) | TYPE (1) | KEY_LEN (4) | KEY | VAL_LEN (4) | VALUE |
-// CRC = checksum(TOTAL_LEN | PAYLOAD)
-func (l *Log) Encode(w io.Writer) error {
-	seeker, ok := w.(io.Seeker)
-	if !ok {
-		return fmt.Errorf("wal writer must be seekable")
+// v1: | CRC (4) | TOTAL_LEN (4) | TYPE (1) | KEY_LEN (4) | KEY | VAL_LEN (4) | VALUE |
+// v2: | CRC (4) | TOTAL_LEN (4) | TYPE (1) | LSN (8) | [TIMESTAMP (8)] | KEY_LEN (4) | KEY | VAL_LEN (4) | VALUE |
+// CRC = checksum(TOTAL_LEN | PAYLOAD), with the algorithm named in the file
+// header (CRC32 IEEE unless chosen with WithChecksum).
+// Records with an LSN are written as v2, with recordFlagLSN set in TYPE.
+// Stamped records set recordFlagTime and carry their timestamp in Unix
+// nanoseconds after the LSN.
+// Batch records replace the body with a batch body, see Batch.
+func (l *Log) Encode(w io.Writer, opts ...CodecOption) error {
+	buf, err := l.AppendEncode(nil, opts...)
+	if err != nil {
+		return err
 	}
 
-	crc := crc32.NewIEEE()
-	mw := io.MultiWriter(w, crc)
+	_, err = w.Write(buf)
+	return err
+}
+
+// AppendEncode appends the encoded record to dst and returns the extended
+// slice. The CRC is computed over the finished payload before anything is
+// written, so the record can be streamed to any io.Writer in a single call.
+func (l *Log) AppendEncode(dst []byte, opts ...CodecOption) ([]byte, error) {
+	e := encoder{keys: codecKeys(opts)}
+	return e.appendRecord(dst, l)
+}
 
-	keyLen := uint32(len(l.key))
-	valLen := uint32(len(l.value))
+// CodecOption configures the record codec used outside a WALWriter and
+// WALReader: Log.Encode, Log.AppendEncode, Decode, DecodeInto and
+// DecodeBytes.
+type CodecOption func(*codecConfig)
 
-	payloadLen := 1 + 4 + keyLen + 4 + valLen
-	totalLen := 4 + payloadLen
+type codecConfig struct {
+	keys KeyProvider
+}
 
-	if totalLen > MaxEntrySize {
-		return fmt.Errorf("entry too large")
+// codecKeys returns the keyring opts ask for, if any. Without options it
+// leaves decoding allocation-free.
+func codecKeys(opts []CodecOption) *keyring {
+	if len(opts) == 0 {
+		return nil
 	}
+	var cfg codecConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newKeyring(cfg.keys)
+}
 
-	if err := binary.Write(w, binary.LittleEndian, InvalidCRC); err != nil {
-		return err
-	} // update later
+// encoder holds the writer's record options and the scratch space they need.
+// The zero value encodes plain records.
+type encoder struct {
+	codec             Codec
+	compressThreshold int
+	maxSize           int                // MaxEntrySize if zero
+	sum               checksum.Algorithm // checksum.Default if zero
+	keys              *keyring
+	body              []byte
+}
 
-	// total len
-	if err := binary.Write(mw, binary.LittleEndian, totalLen); err != nil {
-		return err
+func (e *encoder) appendRecord(dst []byte, l *Log) ([]byte, error) {
+	if err := l.checkOps(); err != nil {
+		return dst, err
 	}
 
-	// TYPE
-	if err := binary.Write(mw, binary.LittleEndian, byte(l.op)); err != nil {
-		return err
+	limit := MaxEntrySize
+	if e.maxSize != 0 {
+		limit = e.maxSize
 	}
 
-	// KEY_LEN
-	if err := binary.Write(mw, binary.LittleEndian, keyLen); err != nil {
-		return err
+	// TOTAL_LEN excludes the CRC
+	if l.encodedSize()-4 > limit {
+		return dst, ErrEntryTooLarge
 	}
 
-	// KEY
-	if _, err := mw.Write(l.key); err != nil {
-		return err
-	}
+	start := len(dst)
 
-	// VAL_LEN
-	if err := binary.Write(mw, binary.LittleEndian, valLen); err != nil {
-		return err
+	// CRC and TOTAL_LEN, filled in once the payload is complete
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+
+	// TYPE
+	typ := byte(l.op)
+	if l.IsBatch() {
+		typ = recordKindBatch
+	}
+	if l.lsn != 0 {
+		typ |= recordFlagLSN
+	}
+	if l.ts != 0 {
+		typ |= recordFlagTime
 	}
+	typPos := len(dst)
+	dst = append(dst, typ)
 
-	// VALUE
-	if _, err := mw.Write(l.value); err != nil {
-		return err
+	// LSN
+	if l.lsn != 0 {
+		dst = binary.LittleEndian.AppendUint64(dst, l.lsn)
 	}
 
-	pos, err := seeker.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return err
+	// TIMESTAMP
+	if l.ts != 0 {
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(l.ts))
 	}
 
-	_, err = seeker.Seek(pos-int64(totalLen)-4, io.SeekStart)
-	if err != nil {
-		return err
+	// BODY
+	bodyStart := len(dst)
+	if e.codec == nil {
+		dst = l.appendBody(dst)
+	} else {
+		e.body = l.appendBody(e.body[:0])
+
+		var compressed bool
+		var err error
+		if dst, compressed, err = e.compressBody(dst, e.body); err != nil {
+			return dst[:start], err
+		}
+		if compressed {
+			dst[typPos] |= recordFlagCompressed
+		} else {
+			dst = append(dst, e.body...)
+		}
 	}
 
-	if err = binary.Write(w, binary.LittleEndian, crc.Sum32()); err != nil {
-		return err
+	if e.keys != nil {
+		dst[typPos] |= recordFlagEncrypted
+
+		var err error
+		if dst, err = e.keys.sealBody(dst, typPos, bodyStart); err != nil {
+			return dst[:start], err
+		}
+		if len(dst)-start-4 > limit {
+			return dst[:start], ErrEntryTooLarge
+		}
 	}
 
-	if _, err = seeker.Seek(pos, io.SeekStart); err != nil {
-		return err
+	binary.LittleEndian.PutUint32(dst[start+4:], uint32(len(dst)-start-4))
+	binary.LittleEndian.PutUint32(dst[start:], e.algorithm().Checksum(dst[start+4:]))
+
+	return dst, nil
+}
+
+func (e *encoder) algorithm() checksum.Algorithm {
+	if e.sum == 0 {
+		return checksum.Default
 	}
+	return e.sum
+}
 
+// checkOps checks the operation of l, or of every operation in its batch.
+func (l *Log) checkOps() error {
+	if !l.IsBatch() {
+		return checkOp(l.op)
+	}
+	for _, op := range l.batch {
+		if err := checkOp(op.op); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (l *Log) appendBody(dst []byte) []byte {
+	if l.IsBatch() {
+		return l.appendBatchBody(dst)
+	}
+	return appendKeyValue(dst, l.key, l.value)
+}
+
+// appendKeyValue appends | KEY_LEN (4) | KEY | VAL_LEN (4) | VALUE |.
+func appendKeyValue(dst, key, value []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(key)))
+	dst = append(dst, key...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(value)))
+	dst = append(dst, value...)
+	return dst
+}
+
 func cleanEOF(err error) error {
 	if err == io.EOF || err == io.ErrUnexpectedEOF {
 		return io.EOF
@@ -135,64 +323,150 @@ func cleanEOF(err error) error {
 	return err
 }
 
-func Decode(r io.Reader) (*Log, error) {
-	var storedCRC uint32
-	if err := binary.Read(r, binary.LittleEndian, &storedCRC); err != nil {
-		return nil, cleanEOF(err)
+// Decode reads the next record from r into a freshly allocated Log.
+func Decode(r io.Reader, opts ...CodecOption) (*Log, error) {
+	var l Log
+	if _, err := DecodeInto(r, &l, nil, opts...); err != nil {
+		return nil, err
 	}
 
-	if storedCRC == InvalidCRC {
-		return nil, io.EOF
+	return &l, nil
+}
+
+// DecodeInto reads the next record from r into l, using scratch as the read
+// buffer, and returns the buffer (grown if the record did not fit) for the
+// next call. Reusing l and the returned buffer across calls makes decoding
+// allocation-free once the buffer is large enough. The key, value and batch
+// operations of l alias the buffer, or l's own buffer for compressed records,
+// and are only valid until the next call. Records are verified with the
+// default checksum, where a WALReader uses the one declared by each file.
+// Encrypted records need WithCodecKeys.
+func DecodeInto(r io.Reader, l *Log, scratch []byte, opts ...CodecOption) ([]byte, error) {
+	return decodeInto(r, l, scratch, checksum.Default, codecKeys(opts))
+}
+
+func decodeInto(r io.Reader, l *Log, scratch []byte, sum checksum.Algorithm, keys *keyring) ([]byte, error) {
+	// CRC (4) | TOTAL_LEN (4)
+	scratch = growScratch(scratch, 0, 8)
+	if _, err := io.ReadFull(r, scratch[:8]); err != nil {
+		return scratch, cleanEOF(err)
 	}
 
-	var totalLen uint32
-	if err := binary.Read(r, binary.LittleEndian, &totalLen); err != nil {
-		return nil, cleanEOF(err)
+	storedCRC := binary.LittleEndian.Uint32(scratch[0:4])
+	if storedCRC == InvalidCRC {
+		return scratch, io.EOF
 	}
 
+	totalLen := binary.LittleEndian.Uint32(scratch[4:8])
 	if totalLen > MaxEntrySize || totalLen < 5 {
-		return nil, ErrCorruptWAL
+		return scratch, ErrCorruptWAL
 	}
 
-	payload := make([]byte, totalLen)
-	binary.LittleEndian.PutUint32(payload[0:4], totalLen)
+	// The CRC covers TOTAL_LEN, so keep it in front of the payload.
+	scratch = growScratch(scratch, 8, 4+int(totalLen))
+	payload := scratch[4:]
 
 	if _, err := io.ReadFull(r, payload[4:]); err != nil {
-		return nil, cleanEOF(err)
+		return scratch, cleanEOF(err)
 	}
 
-	if crc32.ChecksumIEEE(payload) != storedCRC {
-		return nil, ErrCorruptWAL
+	if sum.Checksum(payload) != storedCRC {
+		return scratch, ErrCorruptWAL
 	}
 
-	pos := 4
-
-	var l Log
 	l.crc = storedCRC
+	return scratch, l.decodePayload(payload[4:], keys)
+}
+
+// growScratch returns b resized to n bytes, preserving its first keep bytes.
+func growScratch(b []byte, keep, n int) []byte {
+	if cap(b) < n {
+		b = slices.Grow(b[:keep], n-keep)
+	}
+	return b[:n]
+}
+
+// decodePayload parses everything after TOTAL_LEN, opening encrypted bodies
+// with keys. The key and value alias payload.
+func (l *Log) decodePayload(payload []byte, keys *keyring) error {
+	if len(payload) < 1 {
+		return ErrCorruptWAL
+	}
 
-	l.op = types.Operation(payload[pos])
-	pos++
+	typ := payload[0]
+	if typ&^(recordOpMask|recordKnownFlags) != 0 {
+		return ErrCorruptWAL
+	}
+	kind := typ & recordOpMask
+	if kind > recordKindBatch {
+		return ErrCorruptWAL
+	}
+	header := payload
+	payload = payload[1:]
+
+	l.lsn = 0
+	if typ&recordFlagLSN != 0 {
+		if len(payload) < 8 {
+			return ErrCorruptWAL
+		}
+		l.lsn = binary.LittleEndian.Uint64(payload)
+		payload = payload[8:]
+	}
+	l.ts = 0
+	if typ&recordFlagTime != 0 {
+		if len(payload) < 8 {
+			return ErrCorruptWAL
+		}
+		l.ts = int64(binary.LittleEndian.Uint64(payload))
+		payload = payload[8:]
+	}
+	header = header[:len(header)-len(payload)]
 
-	keyLen := binary.LittleEndian.Uint32(payload[pos:])
-	pos += 4
+	var err error
+	if typ&recordFlagEncrypted != 0 {
+		if payload, err = l.decryptBody(payload, header, keys); err != nil {
+			return err
+		}
+	}
+	if typ&recordFlagCompressed != 0 {
+		if payload, err = l.decompressBody(payload); err != nil {
+			return err
+		}
+	}
 
-	if keyLen > uint32(len(payload))-uint32(pos) {
-		return nil, ErrCorruptWAL
+	if kind == recordKindBatch {
+		l.op, l.key, l.value = 0, nil, nil
+		return l.decodeBatchBody(payload)
 	}
 
-	l.key = make([]byte, keyLen)
-	copy(l.key, payload[pos:pos+int(keyLen)])
-	pos += int(keyLen)
+	l.op = types.Operation(kind)
+	l.batch = nil
+
+	var ok bool
+	if l.key, payload, ok = readLenPrefixed(payload); !ok {
+		return ErrCorruptWAL
+	}
+	if l.value, payload, ok = readLenPrefixed(payload); !ok {
+		return ErrCorruptWAL
+	}
+	if len(payload) != 0 {
+		return ErrCorruptWAL
+	}
 
-	valLen := binary.LittleEndian.Uint32(payload[pos:])
-	pos += 4
+	return nil
+}
 
-	if valLen > uint32(len(payload))-uint32(pos) {
-		return nil, ErrCorruptWAL
+// readLenPrefixed splits a | LEN (4) | DATA | field off the front of b.
+func readLenPrefixed(b []byte) (field, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
 	}
 
-	l.value = make([]byte, valLen)
-	copy(l.value, payload[pos:pos+int(valLen)])
+	n := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	if uint64(n) > uint64(len(b)) {
+		return nil, nil, false
+	}
 
-	return &l, nil
+	return b[:n:n], b[n:], true
 }
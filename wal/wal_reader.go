@@ -1,39 +1,464 @@
 package wal
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"iter"
+	"math"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
 )
 
+// WALReader replays the legacy WAL.log, if present, followed by every segment
+// in id order. Records covered by the last checkpoint are skipped, so replay
+// starts right after it. Files are read with ReadAt, never through the file
+// offset, so cursors created by Cursor can share them.
 type WALReader struct {
-	f *os.File
+	dir        string
+	cfg        readerConfig
+	handles    *fileSet
+	files      []string
+	idx        int
+	f          vfs.File
+	src        *io.SectionReader // reads f from the reader's own offset
+	r          *bufio.Reader
+	cr         countingReader // counts what r has handed out
+	blocks     *blockReader   // used instead of r for framed files
+	hdr        fileHeader
+	size       int64
+	pos        int64 // end of the last record or damage read
+	recStart   int64 // start of the last record read
+	checkpoint uint64
+	seen       uint64 // highest LSN read
+	from       uint64 // records below this LSN are skipped, see SeekTo
+	waited     uint64 // durable LSN at the last wait in Follow
+	keys       *keyring
+
+	// A record read ahead while sizing up damage in a framed file.
+	pending    []byte
+	hasPending bool
+
+	report  RecoveryReport
+	resync  bool // the last error was damage the reader stepped over
+	stopped bool // PointInTime dropped the rest of the log
+
+	// Used instead of fresh allocations under WithBufferReuse.
+	log     Log
+	scratch []byte
+}
+
+const readBufferSize = 64 << 10
+
+type readerConfig struct {
+	reuseBuffers bool
+	recoveryMode RecoveryMode
+	writer       *WALWriter
+	pollInterval time.Duration
+	keys         KeyProvider
+	fs           vfs.FS
+}
+
+type ReaderOption func(*readerConfig)
+
+// WithBufferReuse decodes every record into the same Log and read buffer
+// instead of allocating new ones, which keeps long replays from churning the
+// garbage collector. A record returned by Read or Iter, including its key,
+// value and batch operations, is only valid until the next one is read; copy
+// anything that must outlive that.
+func WithBufferReuse() ReaderOption {
+	return func(c *readerConfig) {
+		c.reuseBuffers = true
+	}
 }
 
-func NewWALReader(dir string) (*WALReader, error) {
-	f, err := os.OpenFile(filepath.Join(dir, WalFilePath), os.O_RDONLY, 0o644)
+// WithReaderFS reads the log from fsys instead of the operating system's
+// file system. A reader tied to a writer by WithFollowWriter uses the
+// writer's file system unless given its own.
+func WithReaderFS(fsys vfs.FS) ReaderOption {
+	return func(c *readerConfig) {
+		c.fs = fsys
+	}
+}
+
+func NewWALReader(dir string, opts ...ReaderOption) (*WALReader, error) {
+	r := &WALReader{dir: dir}
+	r.cfg.pollInterval = DefaultPollInterval
+	for _, opt := range opts {
+		opt(&r.cfg)
+	}
+	if r.cfg.keys != nil {
+		r.keys = newKeyring(r.cfg.keys)
+	} else if r.cfg.writer != nil {
+		r.keys = r.cfg.writer.enc.keys
+	}
+	if r.cfg.fs == nil {
+		r.cfg.fs = vfs.OS()
+		if r.cfg.writer != nil {
+			r.cfg.fs = r.cfg.writer.cfg.fs
+		}
+	}
+	r.handles = newFileSet(r.cfg.fs)
+
+	if err := r.Reset(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func listWALFiles(fsys vfs.FS, dir string) ([]string, error) {
+	var files []string
+
+	legacy := filepath.Join(dir, WalFilePath)
+	if _, err := fsys.Stat(legacy); err == nil {
+		files = append(files, legacy)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	segments, err := segmentmanager.ListSegmentsFS(fsys, dir)
 	if err != nil {
 		return nil, err
 	}
+	for _, s := range segments {
+		files = append(files, s.Path)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no WAL files in %s: %w", dir, os.ErrNotExist)
+	}
+
+	return files, nil
+}
+
+// openWALFile opens the log file at path, validates its header and leaves it
+// positioned at the first record.
+func openWALFile(fsys vfs.FS, path string) (vfs.File, fileHeader, error) {
+	f, err := vfs.Open(fsys, path)
+	if err != nil {
+		return nil, fileHeader{}, err
+	}
+
+	hdr, err := readFileHeader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fileHeader{}, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	return f, hdr, nil
+}
+
+func (w *WALReader) open(idx int) error {
+	path := w.files[idx]
+	f, err := w.handles.open(path)
+	if err != nil {
+		return err
+	}
+
+	src := io.NewSectionReader(f, 0, math.MaxInt64)
+	hdr, err := readFileHeader(src)
+	if err != nil {
+		_ = w.handles.release(f)
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = w.handles.release(f)
+		return err
+	}
+
+	w.idx = idx
+	w.f = f
+	w.src = src
+	w.hdr = hdr
+	w.size = info.Size()
+	w.pos = hdr.size()
+	w.hasPending = false
+
+	if hdr.framed() {
+		if w.blocks == nil {
+			w.blocks = newBlockReader(src, hdr.size(), hdr.checksum)
+		} else {
+			w.blocks.reset(src, hdr.size(), hdr.checksum)
+		}
+		return nil
+	}
+
+	if w.r == nil {
+		w.r = bufio.NewReaderSize(src, readBufferSize)
+	} else {
+		w.r.Reset(src)
+	}
+	w.cr = countingReader{r: w.r}
+
+	return nil
+}
+
+// seek repositions an unframed reader at offset.
+func (w *WALReader) seek(offset int64) error {
+	if _, err := w.src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.r.Reset(w.src)
+	w.cr.n = offset - w.hdr.size()
+	w.pos = offset
+
+	return nil
+}
+
+// openFrom opens the first file at or after idx that still exists. Sealed
+// files can disappear under the reader when a checkpoint removes them.
+func (w *WALReader) openFrom(idx int) error {
+	for ; ; idx++ {
+		err := w.open(idx)
+		if errors.Is(err, os.ErrNotExist) && idx+1 < len(w.files) {
+			continue
+		}
+		return err
+	}
+}
+
+// nextFile moves on to the next file, returning io.EOF after the last one.
+func (w *WALReader) nextFile() error {
+	if w.idx+1 >= len(w.files) {
+		return io.EOF
+	}
+
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	return w.openFrom(w.idx + 1)
+}
+
+// closeFile lets go of the current file.
+func (w *WALReader) closeFile() error {
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.handles.release(w.f)
+	w.f, w.src = nil, nil
+
+	return err
+}
+
+// decode reads the next record of the current file. Damage is stepped over
+// and reported as a *corruptionError; io.EOF means the file is exhausted.
+func (w *WALReader) decode() (*Log, error) {
+	if w.hdr.framed() {
+		return w.decodeFramed()
+	}
+
+	var log *Log
+	var err error
+	if w.cfg.reuseBuffers {
+		w.scratch, err = decodeInto(&w.cr, &w.log, w.scratch, w.hdr.checksum, w.keys)
+		log = &w.log
+	} else {
+		log = new(Log)
+		_, err = decodeInto(&w.cr, log, nil, w.hdr.checksum, w.keys)
+	}
+
+	if err == nil {
+		w.recStart, w.pos = w.pos, w.hdr.size()+w.cr.n
+		return log, nil
+	}
+	if err == io.EOF && w.pos >= w.size {
+		return nil, io.EOF
+	}
+	if err != io.EOF && !errors.Is(err, ErrCorruptWAL) {
+		return nil, err
+	}
+	if err := w.endOfData(); err != nil {
+		return nil, err
+	}
 
-	return &WALReader{f: f}, nil
+	return nil, w.skipDamage(err)
 }
 
+// decodeFramed reassembles the next record of a framed file.
+func (w *WALReader) decodeFramed() (*Log, error) {
+	log, buf := &w.log, w.scratch[:0]
+	if !w.cfg.reuseBuffers {
+		log, buf = new(Log), nil
+	}
+
+	var rec []byte
+	var err error
+	if w.hasPending {
+		rec, w.hasPending = append(buf, w.pending...), false
+	} else {
+		rec, err = w.blocks.next(buf)
+	}
+	if w.cfg.reuseBuffers {
+		w.scratch = rec
+	}
+
+	if err == nil {
+		w.recStart, w.pos = w.blocks.start, w.blocks.end
+		err = decodeRecord(rec, log, w.hdr.checksum, w.keys)
+		if err == nil {
+			return log, nil
+		}
+		if errors.Is(err, ErrCorruptWAL) {
+			err = &corruptionError{offset: w.blocks.start, length: w.blocks.end - w.blocks.start, cause: err}
+		}
+	}
+
+	if err == io.EOF {
+		if w.pos >= w.size {
+			return nil, io.EOF
+		}
+		if err := w.endOfData(); err != nil {
+			return nil, err
+		}
+		// A torn record at the end of the file.
+		err = &corruptionError{offset: w.pos, length: w.size - w.pos}
+	}
+
+	ce, ok := err.(*corruptionError)
+	if !ok {
+		return nil, err
+	}
+
+	return nil, w.measureDamage(ce)
+}
+
+// endOfData returns io.EOF if everything from w.pos on is zero-filled space
+// left by preallocation or segment recycling, rewinding to w.pos so that
+// records written there later can still be read. It returns nil otherwise.
+func (w *WALReader) endOfData() error {
+	zero, err := zeroFilled(w.f, w.pos, w.size)
+	if err != nil || !zero {
+		return err
+	}
+	if err := w.rewind(w.pos); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// measureDamage reads ahead past damage in a framed file to find where it
+// ends: either at the next intact record, which is kept for the next call, or
+// at the end of the file.
+func (w *WALReader) measureDamage(ce *corruptionError) error {
+	for {
+		w.pos = max(w.pos, ce.offset+ce.length)
+
+		rec, err := w.blocks.next(w.pending[:0])
+		w.pending = rec
+		if err == nil {
+			w.hasPending = true
+			return ce
+		}
+
+		next, ok := err.(*corruptionError)
+		if err == io.EOF {
+			ce.length, ce.tail = w.size-ce.offset, true
+			w.pos = w.size
+			return ce
+		}
+		if !ok {
+			return err
+		}
+		ce.length = next.offset + next.length - ce.offset
+	}
+}
+
+// Read returns the next record. What happens to damaged data depends on the
+// recovery mode, see RecoveryMode.
 func (w *WALReader) Read() (*Log, error) {
-	return Decode(w.f)
+	return w.read(false)
+}
+
+// read returns the next record. In live mode, used by Follow, the end of the
+// newest file may hold a record that is still being written; read leaves it
+// for later and returns io.EOF, as it does for records the writer set by
+// WithFollowWriter has not synced yet.
+func (w *WALReader) read(live bool) (*Log, error) {
+	w.resync = false
+	for {
+		if w.stopped {
+			return nil, io.EOF
+		}
+
+		newest := w.idx+1 >= len(w.files)
+
+		log, err := w.decode()
+		if err == nil {
+			if live && w.cfg.writer != nil && log.LSN() > w.cfg.writer.DurableLSN() {
+				if err := w.rewind(w.recStart); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			w.seen = max(w.seen, log.LSN())
+
+			if w.checkpoint != 0 && log.LSN() <= w.checkpoint || log.LSN() < w.from {
+				continue
+			}
+			w.report.Records++
+			return log, nil
+		}
+
+		ce, damaged := err.(*corruptionError)
+		if live && newest && (err == io.EOF || damaged && ce.tail) {
+			offset := w.pos
+			if damaged {
+				offset = ce.offset
+			}
+			caughtUp, err := w.caughtUp(offset)
+			if err != nil {
+				return nil, err
+			}
+			if caughtUp {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		if damaged {
+			if err := w.recover(ce); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err != io.EOF {
+			return nil, err
+		}
+		if live && !w.nextReady() {
+			return nil, io.EOF
+		}
+		if err := w.nextFile(); err != nil {
+			return nil, err
+		}
+	}
 }
 
+// Iter yields every remaining record. It stops after the first error, unless
+// the recovery mode lets the reader step over it and the caller keeps going.
 func (w *WALReader) Iter() iter.Seq2[Log, error] {
 	return func(yield func(Log, error) bool) {
 		for {
-			log, err := Decode(w.f)
+			log, err := w.Read()
 			if err == io.EOF {
 				return
 			}
 			if err != nil {
-				yield(Log{}, err)
-				return
+				if !yield(Log{}, err) || !w.resync {
+					return
+				}
+				continue
 			}
 			if !yield(*log, nil) {
 				return
@@ -42,11 +467,34 @@ func (w *WALReader) Iter() iter.Seq2[Log, error] {
 	}
 }
 
+// Reset rewinds the reader to the first record of the oldest file, picking up
+// any segments created since the reader was opened.
 func (w *WALReader) Reset() error {
-	_, err := w.f.Seek(0, io.SeekStart)
-	return err
+	files, err := listWALFiles(w.cfg.fs, w.dir)
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := readCheckpoint(w.cfg.fs, w.dir)
+	if err != nil {
+		return err
+	}
+	w.checkpoint = checkpoint
+	w.report = RecoveryReport{Mode: w.cfg.recoveryMode}
+	w.stopped = false
+	w.from = 0
+
+	_ = w.closeFile()
+
+	w.files = files
+	return w.openFrom(0)
+}
+
+// CheckpointLSN returns the checkpoint the reader is replaying from.
+func (w *WALReader) CheckpointLSN() uint64 {
+	return w.checkpoint
 }
 
 func (w *WALReader) Close() error {
-	return w.f.Close()
+	return w.closeFile()
 }
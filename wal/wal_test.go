@@ -1,8 +1,10 @@
 package wal
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
 	"testing"
@@ -145,3 +147,256 @@ func TestRejectsInsaneLength(t *testing.T) {
 		}
 	})
 }
+
+func TestEncodeDecodeLSN(t *testing.T) {
+	withTempWAL(t, func(f *os.File) {
+		v1 := NewLog(types.OperationPut, []byte("a"), []byte("1"))
+		v2 := NewLog(types.OperationDelete, []byte("b"), nil)
+		v2.lsn = 1 << 40
+
+		for _, l := range []*Log{v1, v2} {
+			if err := l.Encode(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, _ = f.Seek(0, io.SeekStart)
+
+		got, err := Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LSN() != 0 || string(got.Key()) != "a" {
+			t.Fatalf("v1 record decoded as %v", got)
+		}
+
+		got, err = Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LSN() != 1<<40 || got.Op() != types.OperationDelete || string(got.Key()) != "b" {
+			t.Fatalf("v2 record decoded as %v", got)
+		}
+	})
+}
+
+func TestEncodeNonSeekableWriters(t *testing.T) {
+	l := NewLog(types.OperationPut, []byte("key"), []byte("value"))
+	l.setLSN(3)
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	if err := l.Encode(bw); err != nil {
+		t.Fatal(err)
+	}
+	_ = bw.Flush()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(l.Encode(pw))
+	}()
+
+	for name, r := range map[string]io.Reader{"bufio": &buf, "pipe": pr} {
+		got, err := Decode(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.LSN() != 3 || !bytes.Equal(got.Key(), l.Key()) || !bytes.Equal(got.Value(), l.Value()) {
+			t.Fatalf("%s: mismatch %v", name, got)
+		}
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	records := []*Log{
+		NewLog(types.OperationPut, []byte("a"), []byte("1")),
+		NewLog(types.OperationDelete, []byte("b"), nil),
+	}
+
+	dst := []byte("prefix")
+	for _, l := range records {
+		var err error
+		if dst, err = l.AppendEncode(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.HasPrefix(dst, []byte("prefix")) {
+		t.Fatal("AppendEncode clobbered dst")
+	}
+	if want := len("prefix") + records[0].encodedSize() + records[1].encodedSize(); len(dst) != want {
+		t.Fatalf("expected %d bytes, got %d", want, len(dst))
+	}
+
+	r := bytes.NewReader(dst[len("prefix"):])
+	for i, want := range records {
+		got, err := Decode(r)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if got.Op() != want.Op() || !bytes.Equal(got.Key(), want.Key()) {
+			t.Fatalf("record %d mismatch", i)
+		}
+	}
+}
+
+func TestAppendEncodeTooLarge(t *testing.T) {
+	l := NewLog(types.OperationPut, nil, make([]byte, MaxEntrySize))
+	dst, err := l.AppendEncode([]byte("x"))
+	if err != ErrEntryTooLarge {
+		t.Fatalf("expected ErrEntryTooLarge, got %v", err)
+	}
+	if string(dst) != "x" {
+		t.Fatalf("dst modified on error: %q", dst)
+	}
+}
+
+func encodeRecords(tb testing.TB, n int, valueSize int) []byte {
+	tb.Helper()
+	var buf []byte
+	for i := range n {
+		l := NewLog(types.OperationPut, fmt.Appendf(nil, "key-%08d", i), bytes.Repeat([]byte("v"), valueSize))
+		l.setLSN(uint64(i + 1))
+		var err error
+		if buf, err = l.AppendEncode(buf); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return buf
+}
+
+func TestDecodeIntoMatchesDecode(t *testing.T) {
+	data := encodeRecords(t, 10, 100)
+
+	var l Log
+	var scratch []byte
+	r := bytes.NewReader(data)
+	ref := bytes.NewReader(data)
+	for {
+		var err error
+		scratch, err = DecodeInto(r, &l, scratch)
+		want, wantErr := Decode(ref)
+		if err != wantErr {
+			t.Fatalf("DecodeInto returned %v, Decode returned %v", err, wantErr)
+		}
+		if err != nil {
+			break
+		}
+		if l.LSN() != want.LSN() || !bytes.Equal(l.Key(), want.Key()) || !bytes.Equal(l.Value(), want.Value()) {
+			t.Fatalf("DecodeInto %v != Decode %v", &l, want)
+		}
+	}
+}
+
+func TestDecodeIntoDoesNotAllocate(t *testing.T) {
+	data := encodeRecords(t, 1, 4096)
+	r := bytes.NewReader(data)
+
+	var l Log
+	scratch, err := DecodeInto(r, &l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(data)
+		if scratch, err = DecodeInto(r, &l, scratch); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %.1f per record", allocs)
+	}
+
+	// The decoded key aliases the scratch buffer.
+	if &l.Key()[0] != &scratch[4+4+1+8+4] {
+		t.Fatal("key does not alias the scratch buffer")
+	}
+}
+
+func TestReaderWithBufferReuse(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		_, _ = w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), fmt.Appendf(nil, "v-%d", i)))
+	}
+	b := NewBatch()
+	b.Put([]byte("b-1"), nil)
+	b.Delete([]byte("b-2"))
+	_, _ = w.WriteBatch(b)
+	w.Close()
+
+	reader, err := NewWALReader(dir, WithBufferReuse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.IsBatch() {
+			for _, op := range l.Batch() {
+				keys = append(keys, string(op.Key()))
+			}
+			continue
+		}
+		keys = append(keys, string(l.Key()))
+	}
+
+	want := []string{"k-0", "k-1", "k-2", "k-3", "k-4", "b-1", "b-2"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("got %v want %v", keys, want)
+	}
+}
+
+func benchmarkDecode(b *testing.B, valueSize int, decode func(r io.Reader) error) {
+	data := encodeRecords(b, 1000, valueSize)
+	r := bytes.NewReader(data)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for b.Loop() {
+		r.Reset(data)
+		for {
+			if err := decode(r); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range []int{64, 4096} {
+		b.Run(fmt.Sprintf("value=%d", size), func(b *testing.B) {
+			benchmarkDecode(b, size, func(r io.Reader) error {
+				_, err := Decode(r)
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	for _, size := range []int{64, 4096} {
+		b.Run(fmt.Sprintf("value=%d", size), func(b *testing.B) {
+			var l Log
+			var scratch []byte
+			benchmarkDecode(b, size, func(r io.Reader) error {
+				var err error
+				scratch, err = DecodeInto(r, &l, scratch)
+				return err
+			})
+		})
+	}
+}
@@ -1,61 +1,449 @@
 package wal
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/Priyanshu23/FlashLogGo/checksum"
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
 )
 
-var ErrWALClosed = os.ErrClosed
+var (
+	ErrWALClosed     = os.ErrClosed
+	ErrLSNOutOfOrder = fmt.Errorf("LSN is not above the last one written")
+	ErrQueueFull     = fmt.Errorf("WAL write queue is full")
+
+	// errAbandoned marks a request whose caller gave up before the loop got
+	// to it.
+	errAbandoned = fmt.Errorf("write abandoned")
+)
 
+// WalFilePath is the single-file log written by earlier versions. It is no
+// longer appended to, but readers still replay it ahead of the segments.
 const WalFilePath = "WAL.log"
 
+// LockFilePath is locked by the writer that owns the directory, so a second
+// writer cannot open it, see vfs.FS.Lock.
+const LockFilePath = "LOCK"
+
+const DefaultMaxBatchSize = 256
+
+type config struct {
+	maxSegmentSize int64
+	maxBatchSize   int
+	maxBatchWait   time.Duration
+	syncPolicy     SyncPolicy
+	blockFraming   bool
+	checksum       checksum.Algorithm
+	preallocate    int64
+	recycle        int
+	indexInterval  int64
+	archiveDir     string
+	archiveCodec   Codec
+	clock          Clock
+	fs             vfs.FS
+
+	codec             Codec
+	compressThreshold int
+	keys              KeyProvider
+}
+
+type Option func(*config)
+
+// WithMaxSegmentSize sets the size in bytes at which the writer rotates to a
+// new segment file.
+func WithMaxSegmentSize(size int64) Option {
+	return func(c *config) {
+		c.maxSegmentSize = size
+	}
+}
+
+// WithMaxBatchSize caps how many queued records are committed under a single
+// fsync.
+func WithMaxBatchSize(n int) Option {
+	return func(c *config) {
+		c.maxBatchSize = n
+	}
+}
+
+// WithMaxBatchWait lets the writer hold a batch open for up to d waiting for
+// more records before committing it. Zero commits whatever is already queued.
+func WithMaxBatchWait(d time.Duration) Option {
+	return func(c *config) {
+		c.maxBatchWait = d
+	}
+}
+
+// WithPreallocation reserves space for the active segment in chunks of size
+// bytes, so appends do not grow the file and syncs only flush data. Readers
+// treat zero-filled space at the end of a segment as the end of the log, and
+// the writer cuts it off when it seals a segment, closes, or reopens after a
+// crash.
+func WithPreallocation(size int64) Option {
+	return func(c *config) {
+		c.preallocate = size
+	}
+}
+
+// WithSegmentRecycling keeps up to n checkpointed segments for reuse as new
+// segments instead of deleting them, see segmentmanager.WithRecycling. Only
+// use it when readers are done with a segment before it is checkpointed.
+func WithSegmentRecycling(n int) Option {
+	return func(c *config) {
+		c.recycle = n
+	}
+}
+
+// WithChecksum sets the algorithm new segments are checksummed with. It is
+// recorded in each segment's header, so readers need no matching option, and
+// the segment that is active when the writer opens keeps its own. The default
+// is checksum.CRC32IEEE.
+func WithChecksum(a checksum.Algorithm) Option {
+	return func(c *config) {
+		c.checksum = a
+	}
+}
+
+// WithFS stores the log, its checkpoint, indexes and archive in fsys instead
+// of the operating system's file system.
+func WithFS(fsys vfs.FS) Option {
+	return func(c *config) {
+		c.fs = fsys
+	}
+}
+
+// Stats are cumulative counters for a WALWriter.
+type Stats struct {
+	SyncPolicy    SyncPolicy
+	Records       uint64
+	Batches       uint64
+	Syncs         uint64
+	UnsyncedBytes int64
+	QueueDepth    int
+
+	// TruncatedTailBytes is how much of a torn tail was cut off the newest
+	// segment when the writer was opened.
+	TruncatedTailBytes int64
+	// SealedDamage is the damage, as a reader reports it, that made the writer
+	// leave the newest segment alone and start a new one when it was opened.
+	// It is nil if there was none.
+	SealedDamage error
+}
+
+// writeRequest carries a record to the writer loop and the outcome back to
+// the caller once the record's batch has been synced.
+type writeRequest struct {
+	log     *Log
+	keepLSN bool // the record arrives with its LSN, see Append
+	done    chan error
+	state   atomic.Int32
+}
+
+const (
+	requestQueued = iota
+	requestTaken
+	requestAbandoned
+)
+
+// take claims req for writing. It fails if the caller has abandoned it.
+func (r *writeRequest) take() bool {
+	return r.state.CompareAndSwap(requestQueued, requestTaken)
+}
+
+// abandon withdraws req. It fails if the loop has already taken it.
+func (r *writeRequest) abandon() bool {
+	return r.state.CompareAndSwap(requestQueued, requestAbandoned)
+}
+
 type WALWriter struct {
-	ch     chan *Log
+	ch     chan *writeRequest
 	done   chan struct{}
+	exited chan struct{}
 	wg     sync.WaitGroup
 	closed atomic.Bool
-	f      *os.File
+	sm     segmentmanager.SegmentManager
+	cfg    config
+
+	records atomic.Uint64
+	batches atomic.Uint64
+	syncs   atomic.Uint64
+
+	dir           string
+	lock          io.Closer
+	lastLSN       atomic.Uint64
+	truncatedTail int64
+	sealedDamage  error
+
+	durableLSN atomic.Uint64
+	durableMu  sync.Mutex
+	durableCh  chan struct{} // closed and replaced whenever durableLSN grows
+	shutdown   chan struct{} // closed once Close has synced everything
+
+	checkpointMu sync.Mutex
+	checkpoint   uint64
+	sealedLSNs   map[int]uint64 // highest LSN of each sealed segment seen so far
+
+	// Owned by the loop goroutine.
+	enc      encoder
+	buf      []byte
+	frame    []byte
+	framed   bool // the active segment is block framed
+	blockOff int  // write offset within the active segment's last block
+	index    indexWriter
+	unsynced int64
+	lastSync time.Time
+	syncErr  error
+
+	unsyncedBytes atomic.Int64
 }
 
-func NewWALWriter(buffer int, dir string) (*WALWriter, error) {
-	err := os.MkdirAll(dir, 0o755)
+func NewWALWriter(buffer int, dir string, opts ...Option) (*WALWriter, error) {
+	cfg := config{
+		maxSegmentSize: segmentmanager.DefaultMaxSegmentSize,
+		maxBatchSize:   DefaultMaxBatchSize,
+		syncPolicy:     SyncAlways(),
+		checksum:       checksum.Default,
+		clock:          WallClock(),
+		fs:             vfs.OS(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.maxBatchSize < 1 {
+		cfg.maxBatchSize = 1
+	}
+	if err := cfg.syncPolicy.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checksum.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.archiveDir != "" {
+		if filepath.Clean(cfg.archiveDir) == filepath.Clean(dir) {
+			return nil, fmt.Errorf("WAL archive must not be the WAL directory %s", dir)
+		}
+		if err := cfg.fs.MkdirAll(cfg.archiveDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create WAL archive: %w", err)
+		}
+	}
+
+	if err := cfg.fs.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+	lock, err := cfg.fs.Lock(filepath.Join(dir, LockFilePath))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+		return nil, fmt.Errorf("failed to lock WAL directory: %w", err)
 	}
+	locked := false
+	defer func() {
+		if !locked {
+			_ = lock.Close()
+		}
+	}()
 
-	f, err := os.OpenFile(filepath.Join(dir, WalFilePath), os.O_RDWR|os.O_CREATE, 0o644)
+	keys := newKeyring(cfg.keys)
+	tail, err := recoverTail(cfg.fs, dir, keys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open WAL file: %w", err)
+		return nil, err
 	}
 
-	if _, err := f.Seek(0, io.SeekEnd); err != nil {
-		_ = f.Close()
-		return nil, fmt.Errorf("failed to seek to end of WAL file: %w", err)
+	checkpoint, err := readCheckpoint(cfg.fs, dir)
+	if err != nil {
+		return nil, err
 	}
 
 	w := &WALWriter{
-		ch:   make(chan *Log, buffer),
-		done: make(chan struct{}),
-		f:    f,
+		ch:       make(chan *writeRequest, buffer),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+		cfg:      cfg,
+		lastSync: time.Now(),
+		enc: encoder{
+			codec:             cfg.codec,
+			compressThreshold: cfg.compressThreshold,
+			sum:               tail.sum,
+			keys:              keys,
+		},
+		framed:   tail.framed,
+		blockOff: tail.blockOff,
+		index:    indexWriter{fs: cfg.fs, dir: dir, interval: cfg.indexInterval},
+
+		durableCh: make(chan struct{}),
+		shutdown:  make(chan struct{}),
+
+		dir:        dir,
+		lock:       lock,
+		checkpoint: checkpoint,
+		sealedLSNs: make(map[int]uint64),
+	}
+	if cfg.blockFraming {
+		w.enc.maxSize = MaxFramedEntrySize
+	}
+
+	w.sm, err = segmentmanager.NewDiskSegmentManager(dir,
+		segmentmanager.WithMaxSegmentSize(cfg.maxSegmentSize),
+		segmentmanager.WithSegmentHeader(w.writeHeader),
+		segmentmanager.WithPreallocation(cfg.preallocate),
+		segmentmanager.WithRecycling(cfg.recycle),
+		segmentmanager.WithFS(cfg.fs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL segments: %w", err)
 	}
 
+	// Every segment may have been checkpointed away, but LSNs must never be
+	// reused.
+	w.lastLSN.Store(max(tail.lastLSN, checkpoint))
+	w.durableLSN.Store(w.lastLSN.Load())
+	w.truncatedTail = tail.truncated
+	w.sealedDamage = tail.sealed
+	if o, ok := cfg.clock.(observer); ok {
+		o.Observe(tail.lastTime)
+	}
+
+	locked = true
 	w.wg.Add(1)
 	go w.loop()
 
 	return w, nil
 }
 
-func (w *WALWriter) Write(l *Log) error {
+// writeHeader starts a new segment in the configured framing.
+func (w *WALWriter) writeHeader(dst io.Writer) error {
+	hdr := newFileHeader()
+	hdr.checksum = w.cfg.checksum
+	if w.cfg.blockFraming {
+		hdr.flags |= headerFlagBlocks
+	}
+
+	w.framed = w.cfg.blockFraming
+	w.blockOff = 0
+	w.enc.sum = w.cfg.checksum
+
+	return hdr.encode(dst)
+}
+
+// Write assigns l the next LSN and a timestamp from the clock, replacing any
+// l already had, queues it and blocks until the batch containing it has been
+// committed. Under SyncAlways that means fsynced, so a
+// nil error means the record is durable; other policies return once the
+// record reaches the operating system. The error is the one from encoding l or
+// from the fsync covering it.
+func (w *WALWriter) Write(l *Log) (uint64, error) {
+	return w.WriteContext(context.Background(), l)
+}
+
+// WriteContext is Write, but gives up once ctx is done, returning ctx.Err().
+// That happens while waiting for room in the queue, or while the record is
+// queued; l is then not written. A record the writer has already started on
+// is seen through, so WriteContext may return after ctx is done with the
+// outcome of the write.
+func (w *WALWriter) WriteContext(ctx context.Context, l *Log) (uint64, error) {
+	req := &writeRequest{log: l, done: make(chan error, 1)}
+
 	select {
-	case w.ch <- l:
-		return nil
+	case w.ch <- req:
+	case <-w.done:
+		return 0, ErrWALClosed
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	err := w.await(ctx, req)
+	return l.LSN(), err
+}
+
+// TryWrite is Write, but fails with ErrQueueFull instead of waiting when the
+// queue has no room, so callers can shed load. Once queued, the record is
+// waited for like Write. An unbuffered writer only has room while it is idle.
+func (w *WALWriter) TryWrite(l *Log) (uint64, error) {
+	if w.closed.Load() {
+		return 0, ErrWALClosed
+	}
+
+	req := &writeRequest{log: l, done: make(chan error, 1)}
+	select {
+	case w.ch <- req:
+	default:
+		return 0, fmt.Errorf("%w: %d of %d queued", ErrQueueFull, w.QueueDepth(), w.QueueCapacity())
+	}
+
+	err := w.await(context.Background(), req)
+	return l.LSN(), err
+}
+
+// QueueDepth returns how many records are waiting for the writer.
+func (w *WALWriter) QueueDepth() int {
+	return len(w.ch)
+}
+
+// QueueCapacity returns how many records the queue holds before writes block,
+// the buffer passed to NewWALWriter.
+func (w *WALWriter) QueueCapacity() int {
+	return cap(w.ch)
+}
+
+// Append writes a record that already carries its LSN, such as one shipped
+// from a replication primary, and blocks like Write. The LSN must be above
+// LastLSN; gaps are allowed. A timestamp on l is kept too, while a record
+// without one is stamped like Write's.
+func (w *WALWriter) Append(l *Log) error {
+	if l.LSN() == 0 {
+		return fmt.Errorf("%w: record has no LSN", ErrLSNOutOfOrder)
+	}
+	req := &writeRequest{log: l, keepLSN: true, done: make(chan error, 1)}
+
+	select {
+	case w.ch <- req:
 	case <-w.done:
 		return ErrWALClosed
 	}
+
+	return w.await(context.Background(), req)
+}
+
+// await waits for the loop to commit req, or for ctx to be done while req is
+// still queued.
+func (w *WALWriter) await(ctx context.Context, req *writeRequest) error {
+	cancel := ctx.Done()
+	for {
+		select {
+		case err := <-req.done:
+			return err
+		case <-w.exited:
+			// The loop may have answered just before exiting.
+			select {
+			case err := <-req.done:
+				return err
+			default:
+				return ErrWALClosed
+			}
+		case <-cancel:
+			if req.abandon() {
+				return ctx.Err()
+			}
+			// Already being written; wait for the outcome.
+			cancel = nil
+		}
+	}
+}
+
+// Dir returns the directory the writer appends to.
+func (w *WALWriter) Dir() string {
+	return w.dir
+}
+
+// LastLSN returns the LSN of the most recently written record.
+func (w *WALWriter) LastLSN() uint64 {
+	return w.lastLSN.Load()
 }
 
 func (w *WALWriter) Close() {
@@ -65,30 +453,254 @@ func (w *WALWriter) Close() {
 
 	close(w.done)
 	w.wg.Wait()
-	_ = w.f.Close()
+	_ = w.index.close()
+
+	// Wait for an in-flight Checkpoint before closing the segments under it.
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+	if err := w.sm.Close(); err == nil {
+		w.markDurable(w.lastLSN.Load())
+	}
+	_ = w.lock.Close()
+	close(w.shutdown)
+}
+
+// Stats returns a snapshot of the writer's counters.
+func (w *WALWriter) Stats() Stats {
+	return Stats{
+		SyncPolicy:    w.cfg.syncPolicy,
+		Records:       w.records.Load(),
+		Batches:       w.batches.Load(),
+		Syncs:         w.syncs.Load(),
+		UnsyncedBytes: w.unsyncedBytes.Load(),
+		QueueDepth:    w.QueueDepth(),
+
+		TruncatedTailBytes: w.truncatedTail,
+		SealedDamage:       w.sealedDamage,
+	}
+}
+
+// collect tops batch up with queued records until it is full, holding it open
+// for at most maxBatchWait.
+func (w *WALWriter) collect(batch []*writeRequest) []*writeRequest {
+	var timeout <-chan time.Time
+	if w.cfg.maxBatchWait > 0 {
+		timer := time.NewTimer(w.cfg.maxBatchWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch) < w.cfg.maxBatchSize {
+		select {
+		case req := <-w.ch:
+			batch = append(batch, req)
+			continue
+		default:
+		}
+
+		if timeout == nil {
+			return batch
+		}
+
+		select {
+		case req := <-w.ch:
+			batch = append(batch, req)
+		case <-timeout:
+			return batch
+		case <-w.done:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// sync fsyncs the active segment. A failure is held back and reported to the
+// callers of the next batch if nobody is waiting on this one.
+func (w *WALWriter) sync() error {
+	err := w.sm.Sync()
+	w.syncs.Add(1)
+	if err != nil {
+		w.syncErr = fmt.Errorf("failed to sync WAL: %w", err)
+		return w.syncErr
+	}
+
+	w.unsynced = 0
+	w.unsyncedBytes.Store(0)
+	w.lastSync = time.Now()
+	w.markDurable(w.lastLSN.Load())
+
+	return nil
+}
+
+// append encodes l into the writer's reusable buffer and writes it to the
+// active segment in one call, split into fragments if the segment is block
+// framed.
+func (w *WALWriter) append(l *Log) error {
+	sum := w.enc.sum
+	rec, err := w.enc.appendRecord(w.buf[:0], l)
+	if err != nil {
+		return err
+	}
+	w.buf = rec
+
+	// The segment manager may rotate before calling back, so the framing and
+	// checksum are only known for sure inside the callback.
+	size := len(rec)
+	if w.framed {
+		size = framedSize(len(rec), w.blockOff)
+	}
+
+	err = w.sm.WriteActive(size, func(dst io.Writer) error {
+		if w.enc.sum != sum {
+			binary.LittleEndian.PutUint32(rec, w.enc.algorithm().Checksum(rec[4:]))
+		}
+
+		out, off := rec, w.blockOff
+		if w.framed {
+			w.frame, off = appendFragments(w.frame[:0], rec, off, w.enc.algorithm())
+			out = w.frame
+		} else if len(rec)-4 > MaxEntrySize {
+			return ErrEntryTooLarge
+		}
+
+		if _, err := dst.Write(out); err != nil {
+			return err
+		}
+
+		w.blockOff = off
+		size = len(out)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.unsynced += int64(size)
+
+	if w.cfg.indexInterval > 0 {
+		// The index is only a hint, so the record stands even if its entry
+		// cannot be written.
+		id, end := w.sm.Active()
+		_ = w.index.add(id, end-int64(size), l.lsn)
+	}
+
+	return nil
+}
+
+// commit appends every record in batch, fsyncs if the sync policy asks for it
+// and reports the outcome to each caller. A record that fails to encode is
+// discarded without affecting the rest of the batch; a failed fsync fails
+// every record written since the last successful one.
+func (w *WALWriter) commit(batch []*writeRequest) {
+	errs := make([]error, len(batch))
+	lsn := w.lastLSN.Load()
+	for i, req := range batch {
+		if !req.take() {
+			errs[i] = errAbandoned
+			continue
+		}
+
+		next := lsn + 1
+		if req.keepLSN {
+			if req.log.lsn <= lsn {
+				errs[i] = fmt.Errorf("%w: %d after %d", ErrLSNOutOfOrder, req.log.lsn, lsn)
+				continue
+			}
+			next = req.log.lsn
+		}
+
+		ts := req.log.ts
+		w.stamp(req.log, req.keepLSN)
+		req.log.setLSN(next)
+		if errs[i] = w.append(req.log); errs[i] != nil {
+			if !req.keepLSN {
+				req.log.setLSN(0)
+			}
+			req.log.setTimestamp(ts)
+			continue
+		}
+		lsn = next
+	}
+	w.lastLSN.Store(lsn)
+	w.unsyncedBytes.Store(w.unsynced)
+
+	// An earlier background fsync failed, so the data acknowledged since then
+	// may be gone. Surface that rather than pretending this batch is safe.
+	syncErr := w.syncErr
+	if w.cfg.syncPolicy.shouldSync(w.unsynced, time.Since(w.lastSync)) {
+		if err := w.sync(); err != nil {
+			syncErr = err
+		} else {
+			syncErr = nil
+			w.syncErr = nil
+		}
+	}
+
+	for i, req := range batch {
+		if errs[i] == nil {
+			errs[i] = syncErr
+		}
+		if errs[i] == nil {
+			w.records.Add(1)
+		}
+		req.done <- errs[i]
+	}
+	w.batches.Add(1)
+}
+
+// stamp gives l a timestamp from the clock, or none without a clock, replacing
+// any it already had. A record appended with a timestamp of its own, see
+// Append, keeps it if keep is set, and the clock observes it.
+func (w *WALWriter) stamp(l *Log, keep bool) {
+	c := w.cfg.clock
+	if keep && l.ts != 0 {
+		if o, ok := c.(observer); ok {
+			o.Observe(l.ts)
+		}
+		return
+	}
+	if c == nil {
+		l.setTimestamp(0)
+		return
+	}
+	l.setTimestamp(c.Now())
+}
+
+// tick runs the interval policy's background fsync.
+func (w *WALWriter) tick() {
+	if w.cfg.syncPolicy.shouldSync(w.unsynced, time.Since(w.lastSync)) {
+		_ = w.sync()
+	}
 }
 
 func (w *WALWriter) loop() {
 	defer w.wg.Done()
+	defer close(w.exited)
+
+	batch := make([]*writeRequest, 0, w.cfg.maxBatchSize)
+
+	var ticks <-chan time.Time
+	if w.cfg.syncPolicy.mode == syncInterval {
+		ticker := time.NewTicker(w.cfg.syncPolicy.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
 
 	for {
 		select {
-		case l := <-w.ch:
-			err := l.Encode(w.f)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed to write WAL: %v\n", err)
-			}
-			_ = w.f.Sync()
+		case <-ticks:
+			w.tick()
+		case req := <-w.ch:
+			batch = w.collect(append(batch[:0], req))
+			w.commit(batch)
 		case <-w.done:
 			// Drain remaining items in channel before exiting
 			for {
 				select {
-				case l := <-w.ch:
-					err := l.Encode(w.f)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "failed to write WAL: %v\n", err)
-					}
-					_ = w.f.Sync()
+				case req := <-w.ch:
+					batch = w.collect(append(batch[:0], req))
+					w.commit(batch)
 				default:
 					return
 				}
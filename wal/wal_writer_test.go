@@ -1,34 +1,115 @@
 package wal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/Priyanshu23/FlashLogGo/segmentmanager"
 	"github.com/Priyanshu23/FlashLogGo/types"
+	"github.com/Priyanshu23/FlashLogGo/vfs"
 )
 
 func TestWALWriteBlocksUntilDurable(t *testing.T) {
 	dirName := t.TempDir()
-	w, _ := NewWALWriter(1, dirName)
+	w, err := NewWALWriter(1, dirName)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer w.Close()
 
 	l := NewLog(types.OperationPut, []byte("a"), []byte("1"))
+	if _, err := w.Write(l); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record must already be on disk, without closing the writer.
+	reader, err := NewWALReader(dirName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
 
-	start := time.Now()
+	got, err := reader.Read()
+	if err != nil {
+		t.Fatalf("record not durable after Write returned: %v", err)
+	}
+	if !bytes.Equal(got.Key(), l.Key()) {
+		t.Fatalf("got key %s", got.Key())
+	}
 
-	go func() {
-		if err := w.Write(l); err != nil {
-			t.Error(err)
+	if stats := w.Stats(); stats.Syncs != 1 {
+		t.Fatalf("expected 1 fsync, got %d", stats.Syncs)
+	}
+}
+
+func TestWALWriteReportsEncodeError(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	huge := NewLog(types.OperationPut, []byte("k"), make([]byte, MaxEntrySize))
+	if _, err := w.Write(huge); !errors.Is(err, ErrEntryTooLarge) {
+		t.Fatalf("expected ErrEntryTooLarge, got %v", err)
+	}
+
+	if _, err := w.Write(NewLog(types.OperationPut, []byte("k"), []byte("v"))); err != nil {
+		t.Fatalf("writer unusable after failed record: %v", err)
+	}
+}
+
+func TestWriteRejectsInvalidOperation(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 is the batch kind and 0x10 up are record flags.
+	for _, op := range []types.Operation{2, 0x0F, 0x10, 0x80, -1} {
+		if _, err := NewLog(op, []byte("a"), []byte("1")).AppendEncode(nil); !errors.Is(err, ErrInvalidOperation) {
+			t.Fatalf("op %d: expected ErrInvalidOperation from AppendEncode, got %v", op, err)
+		}
+		if _, err := w.Write(NewLog(op, []byte("a"), []byte("1"))); !errors.Is(err, ErrInvalidOperation) {
+			t.Fatalf("op %d: expected ErrInvalidOperation from Write, got %v", op, err)
 		}
-	}()
 
-	time.Sleep(10 * time.Millisecond)
+		b := NewBatch()
+		b.Put([]byte("b"), []byte("2"))
+		if err := b.Add(op, []byte("a"), []byte("1")); !errors.Is(err, ErrInvalidOperation) || b.Len() != 1 {
+			t.Fatalf("op %d: expected ErrInvalidOperation from Add, got %v with %d operations", op, err, b.Len())
+		}
+		l := b.Log()
+		l.batch = append(l.batch, NewLog(op, []byte("a"), []byte("1")))
+		if _, err := w.Write(l); !errors.Is(err, ErrInvalidOperation) {
+			t.Fatalf("op %d: expected ErrInvalidOperation from a batch, got %v", op, err)
+		}
+	}
+
+	if _, err := w.Write(NewLog(types.OperationDelete, []byte("k"), nil)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
 
-	if time.Since(start) < 10*time.Millisecond {
-		t.Fatal("Write returned before fsync")
+	w, err = NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatalf("reopen after rejected writes: %v", err)
+	}
+	w.Close()
+	if keys := readKeys(t, dir); fmt.Sprint(keys) != "[k]" {
+		t.Fatalf("got %v", keys)
 	}
 }
 
@@ -47,7 +128,7 @@ func TestWALConcurrentWrites(t *testing.T) {
 		go func(i int) {
 			defer wg.Done()
 			l := NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), fmt.Appendf(nil, "v-%d", i))
-			err := w.Write(l)
+			_, err := w.Write(l)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -91,7 +172,7 @@ func TestWALCloseUnblocksWriters(t *testing.T) {
 	defer w.Close()
 
 	go func() {
-		_ = w.Write(NewLog(types.OperationPut, []byte("x"), []byte("1")))
+		_, _ = w.Write(NewLog(types.OperationPut, []byte("x"), []byte("1")))
 	}()
 
 	time.Sleep(5 * time.Millisecond)
@@ -100,7 +181,7 @@ func TestWALCloseUnblocksWriters(t *testing.T) {
 	done := make(chan struct{})
 
 	go func() {
-		_ = w.Write(NewLog(types.OperationPut, []byte("y"), []byte("2")))
+		_, _ = w.Write(NewLog(types.OperationPut, []byte("y"), []byte("2")))
 		close(done)
 	}()
 
@@ -110,3 +191,405 @@ func TestWALCloseUnblocksWriters(t *testing.T) {
 		t.Fatal("writer blocked after Close")
 	}
 }
+
+// gatedKeys holds the writer loop inside CurrentKey until release is closed,
+// so tests can fill the queue behind a record being written.
+type gatedKeys struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGatedKeys() *gatedKeys {
+	return &gatedKeys{entered: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (g *gatedKeys) CurrentKey() (uint32, []byte, error) {
+	select {
+	case g.entered <- struct{}{}:
+	default:
+	}
+	<-g.release
+	return 1, testKey1, nil
+}
+
+func (g *gatedKeys) Key(uint32) ([]byte, error) {
+	return testKey1, nil
+}
+
+func TestWALBackpressure(t *testing.T) {
+	dir := t.TempDir()
+	gate := newGatedKeys()
+	w, err := NewWALWriter(1, dir, WithEncryption(gate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	held := make(chan error, 1)
+	go func() {
+		_, err := w.Write(NewLog(types.OperationPut, []byte("held"), jsonValue(4)))
+		held <- err
+	}()
+	<-gate.entered
+
+	// Queued behind the held record until the deadline passes.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := w.WriteContext(ctx, NewLog(types.OperationPut, []byte("late"), jsonValue(4))); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	if depth := w.QueueDepth(); depth != 1 || w.QueueCapacity() != 1 || w.Stats().QueueDepth != 1 {
+		t.Fatalf("expected a full queue of 1, got %d of %d", depth, w.QueueCapacity())
+	}
+	if _, err := w.TryWrite(NewLog(types.OperationPut, []byte("shed"), jsonValue(4))); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.WriteContext(canceled, NewLog(types.OperationPut, []byte("canceled"), jsonValue(8))); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Canceled, got %v", err)
+	}
+
+	close(gate.release)
+	if err := <-held; err != nil {
+		t.Fatal(err)
+	}
+
+	lsn, err := w.TryWrite(NewLog(types.OperationPut, []byte("after"), jsonValue(5)))
+	for errors.Is(err, ErrQueueFull) {
+		// The abandoned record may still be waiting to be skipped.
+		time.Sleep(time.Millisecond)
+		lsn, err = w.TryWrite(NewLog(types.OperationPut, []byte("after"), jsonValue(5)))
+	}
+	if err != nil || lsn != 2 {
+		t.Fatalf("expected LSN 2, got %d, %v", lsn, err)
+	}
+	if stats := w.Stats(); stats.Records != 2 || stats.QueueDepth != 0 {
+		t.Fatalf("expected 2 records and an empty queue, got %+v", stats)
+	}
+
+	keys, err := readEncrypted(t, dir, gate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[held after]" {
+		t.Fatalf("got %v", keys)
+	}
+}
+
+func TestWALWriteContextAfterClose(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	l := NewLog(types.OperationPut, []byte("k"), []byte("v"))
+	if _, err := w.WriteContext(context.Background(), l); !errors.Is(err, ErrWALClosed) {
+		t.Fatalf("WriteContext: expected ErrWALClosed, got %v", err)
+	}
+	if _, err := w.TryWrite(l); !errors.Is(err, ErrWALClosed) {
+		t.Fatalf("TryWrite: expected ErrWALClosed, got %v", err)
+	}
+}
+
+func TestWALRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(8, dir, WithMaxSegmentSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const N = 20
+	for i := range N {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%02d", i), fmt.Appendf(nil, "v-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	segments, err := segmentmanager.ListSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected rotation, got %d segment(s)", len(segments))
+	}
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	i := 0
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("k-%02d", i); string(l.Key()) != want {
+			t.Fatalf("record %d: got key %s want %s", i, l.Key(), want)
+		}
+		i++
+	}
+
+	if i != N {
+		t.Fatalf("expected %d records, got %d", N, i)
+	}
+}
+
+func TestWALReaderReplaysLegacyFileFirst(t *testing.T) {
+	dir := t.TempDir()
+
+	legacy, err := os.Create(filepath.Join(dir, WalFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewLog(types.OperationPut, []byte("old"), []byte("1")).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	_ = legacy.Close()
+
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write(NewLog(types.OperationPut, []byte("new"), []byte("2")))
+	w.Close()
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var keys []string
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(l.Key()))
+	}
+
+	if len(keys) != 2 || keys[0] != "old" || keys[1] != "new" {
+		t.Fatalf("unexpected replay order %v", keys)
+	}
+}
+
+func writeConcurrently(t *testing.T, w *WALWriter, n int) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), nil)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWALGroupCommit(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(100, dir, WithMaxBatchWait(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const N = 100
+	writeConcurrently(t, w, N)
+	w.Close()
+
+	stats := w.Stats()
+	if stats.Records != N {
+		t.Fatalf("expected %d records, got %d", N, stats.Records)
+	}
+	if stats.Syncs >= N {
+		t.Fatalf("expected fewer than %d fsyncs, got %d", N, stats.Syncs)
+	}
+}
+
+func TestWALMaxBatchSize(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(100, dir, WithMaxBatchSize(10), WithMaxBatchWait(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const N = 100
+	writeConcurrently(t, w, N)
+	w.Close()
+
+	if stats := w.Stats(); stats.Batches < N/10 {
+		t.Fatalf("expected at least %d batches, got %d", N/10, stats.Batches)
+	}
+}
+
+func TestWALAssignsLSNs(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 5 {
+		lsn, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", i), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lsn != uint64(i+1) {
+			t.Fatalf("write %d: got LSN %d", i, lsn)
+		}
+	}
+	w.Close()
+
+	// A reopened writer continues where the previous one stopped.
+	w, err = NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.LastLSN() != 5 {
+		t.Fatalf("expected LastLSN 5 after reopen, got %d", w.LastLSN())
+	}
+	lsn, err := w.Write(NewLog(types.OperationPut, []byte("k-5"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 6 {
+		t.Fatalf("expected LSN 6 after reopen, got %d", lsn)
+	}
+	w.Close()
+
+	reader, err := NewWALReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	want := uint64(1)
+	for l, err := range reader.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.LSN() != want {
+			t.Fatalf("expected LSN %d, got %d", want, l.LSN())
+		}
+		want++
+	}
+	if want != 7 {
+		t.Fatalf("expected 6 records, got %d", want-1)
+	}
+}
+
+func TestAppendKeepsLSN(t *testing.T) {
+	w, err := NewWALWriter(1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	appendAt := func(lsn uint64) error {
+		l := NewLog(types.OperationPut, fmt.Appendf(nil, "k-%d", lsn), nil)
+		l.setLSN(lsn)
+		return w.Append(l)
+	}
+
+	for _, lsn := range []uint64{5, 7} {
+		if err := appendAt(lsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, lsn := range []uint64{0, 6, 7} {
+		if err := appendAt(lsn); !errors.Is(err, ErrLSNOutOfOrder) {
+			t.Fatalf("expected ErrLSNOutOfOrder for LSN %d, got %v", lsn, err)
+		}
+	}
+
+	lsn, err := w.Write(NewLog(types.OperationPut, []byte("next"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 8 {
+		t.Fatalf("expected LSN 8 after appending 7, got %d", lsn)
+	}
+}
+
+func TestWALInMemory(t *testing.T) {
+	fsys := vfs.NewMem()
+	dir, archive := "/db/wal", "/db/archive"
+
+	w, err := NewWALWriter(1, dir, WithFS(fsys), WithMaxSegmentSize(1<<10), WithOffsetIndex(256),
+		WithPreallocation(512), WithArchive(archive, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 40 {
+		if _, err := w.Write(NewLog(types.OperationPut, fmt.Appendf(nil, "key-%d", i), make([]byte, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Checkpoint(20); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	if _, err := os.Stat("/db"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("the in-memory log touched the disk: %v", err)
+	}
+
+	r, err := NewWALReader(dir, WithReaderFS(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if err := r.SeekTo(30); err != nil {
+		t.Fatal(err)
+	}
+	var lsns []uint64
+	for l, err := range r.Iter() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lsns = append(lsns, l.LSN())
+	}
+	if len(lsns) != 11 || lsns[0] != 30 {
+		t.Fatalf("expected LSNs 30 to 40, got %v", lsns)
+	}
+
+	_, last, err := restoreLSNs(archive, WithRestoreFS(fsys), WithRestoreWAL(dir))
+	if err != nil || last != 40 {
+		t.Fatalf("restored up to %d: %v", last, err)
+	}
+}
+
+func TestWALWriterLocksDirectory(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWALWriter(1, dir); !errors.Is(err, vfs.ErrLocked) {
+		t.Fatalf("expected a second writer to fail with vfs.ErrLocked, got %v", err)
+	}
+
+	w.Close()
+	w, err = NewWALWriter(1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+}